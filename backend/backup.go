@@ -0,0 +1,411 @@
+package backend
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	backupsDirname           = "october/backups"
+	backupTimestampLayout    = "20060102T150405Z"
+	backupExtension          = ".tar.gz"
+	DEFAULT_BACKUP_RETENTION = 10
+)
+
+// backupAssets are the paths on a device, besides the database, that hold annotations
+// which can't be recreated if they are lost
+var backupAssets = []string{
+	filepath.Join(".kobo", "version"),
+	filepath.Join(".kobo", "markups"),
+	filepath.Join("Digital Editions", "Annotations"),
+}
+
+var unsafeBackupChars = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+type BackupInfo struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Device    string `json:"device"`
+	CreatedAt string `json:"created_at"`
+	Size      int64  `json:"size"`
+	// seq orders backups of a device that were taken within the same second
+	seq int
+}
+
+// nextBackupName names a backup after its device and the time it was taken, adding a
+// sequence number when another backup of the device already has that name so that
+// backups taken within the same second never replace one another
+func nextBackupName(dir string, device string, now time.Time) string {
+	timestamp := now.UTC().Format(backupTimestampLayout)
+	name := fmt.Sprintf("%s_%s%s", device, timestamp, backupExtension)
+	for seq := 2; backupNameTaken(filepath.Join(dir, name)); seq++ {
+		name = fmt.Sprintf("%s_%s-%d%s", device, timestamp, seq, backupExtension)
+	}
+	return name
+}
+
+func backupNameTaken(path string) bool {
+	for _, candidate := range []string{path, path + ".tmp"} {
+		if _, err := os.Lstat(candidate); !os.IsNotExist(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// BackupKobo archives the selected device's database along with its annotation files,
+// then prunes older backups of the same device according to the retention setting
+func (b *Backend) BackupKobo() (BackupInfo, error) {
+	dir, err := b.backupsDir()
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	return createBackup(b.SelectedKobo, dir, b.Settings.BackupRetention, time.Now(), b.logger)
+}
+
+// ListBackups returns every backup that has been taken, newest first
+func (b *Backend) ListBackups() ([]BackupInfo, error) {
+	dir, err := b.backupsDir()
+	if err != nil {
+		return nil, err
+	}
+	return listBackups(dir)
+}
+
+// RestoreBackup extracts the named backup into dir, laid out the same way as the device
+// so that it can be read with the local database options. Existing files are never overwritten.
+func (b *Backend) RestoreBackup(name string, dir string) error {
+	backups, err := b.backupsDir()
+	if err != nil {
+		return err
+	}
+	return restoreBackup(backups, name, dir, b.logger)
+}
+
+func (b *Backend) backupsDir() (string, error) {
+	dir, err := LocateDataFile(backupsDirname, b.portable)
+	if err != nil {
+		b.logger.Error("Failed to create backup directory. Do you have proper permissions?",
+			slog.String("error", err.Error()),
+		)
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return dir, nil
+}
+
+func createBackup(kb Kobo, dir string, retention int, now time.Time, logger *slog.Logger) (BackupInfo, error) {
+	device := backupDeviceName(kb)
+	name := nextBackupName(dir, device, now)
+	logger.Info("Backing up kobo",
+		slog.String("db_path", kb.DbPath),
+		slog.String("backup", name),
+	)
+	staging, err := os.MkdirTemp("", "noctober-backup")
+	if err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to create staging directory for backup: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	snapshot := filepath.Join(staging, "KoboReader.sqlite")
+	if err := snapshotDatabase(kb.DbPath, snapshot); err != nil {
+		logger.Error("Failed to snapshot kobo database",
+			slog.String("error", err.Error()),
+			slog.String("db_path", kb.DbPath),
+		)
+		return BackupInfo{}, err
+	}
+
+	archivePath := filepath.Join(dir, name)
+	if err := writeBackupArchive(archivePath, snapshot, kb.MntPath, logger); err != nil {
+		os.Remove(archivePath + ".tmp")
+		return BackupInfo{}, err
+	}
+	info, err := backupInfo(archivePath)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	logger.Info("Successfully backed up kobo",
+		slog.String("backup", archivePath),
+		slog.Int64("size", info.Size),
+	)
+	if err := pruneBackups(dir, device, retention, logger); err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+// snapshotDatabase copies the database through SQLite itself so that anything still sitting
+// in the write ahead log is included and a write in progress can't leave a torn copy
+func snapshotDatabase(dbPath string, dest string) error {
+	if _, err := os.Stat(dbPath); err != nil {
+		return fmt.Errorf("failed to find kobo database to back up: %w", err)
+	}
+	// The device's database is only ever read so that closing the connection can't checkpoint
+	// or truncate its write ahead log
+	dsn, err := readOnlyDSN(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open kobo database for backup: %w", err)
+	}
+	source, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return fmt.Errorf("failed to open kobo database for backup: %w", err)
+	}
+	defer closeDB(source)
+	if err := source.Exec("VACUUM INTO ?", dest).Error; err != nil {
+		return fmt.Errorf("failed to copy kobo database: %w", err)
+	}
+	copied, err := gorm.Open(sqlite.Open(dest), &gorm.Config{})
+	if err != nil {
+		return fmt.Errorf("failed to open backup of kobo database: %w", err)
+	}
+	defer closeDB(copied)
+	var problems []string
+	if err := copied.Raw("PRAGMA integrity_check").Scan(&problems).Error; err != nil {
+		return fmt.Errorf("failed to check integrity of backup: %w", err)
+	}
+	if len(problems) != 1 || problems[0] != "ok" {
+		return fmt.Errorf("backup of kobo database failed its integrity check: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func closeDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// writeBackupArchive writes the snapshot and any annotation assets under mntPath to a gzipped tarball,
+// only moving it into place once it is complete
+func writeBackupArchive(archivePath string, snapshot string, mntPath string, logger *slog.Logger) error {
+	f, err := os.OpenFile(archivePath+".tmp", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create backup archive: %w", err)
+	}
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	err = addFileToArchive(tw, snapshot, filepath.Join(".kobo", "KoboReader.sqlite"))
+	for _, asset := range backupAssets {
+		if err != nil {
+			break
+		}
+		assetPath := filepath.Join(mntPath, asset)
+		if _, statErr := os.Stat(assetPath); statErr != nil {
+			logger.Debug("Skipping backup of missing asset",
+				slog.String("path", assetPath),
+			)
+			continue
+		}
+		err = filepath.WalkDir(assetPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(mntPath, path)
+			if err != nil {
+				return err
+			}
+			return addFileToArchive(tw, path, rel)
+		})
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gw.Close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write backup archive: %w", err)
+	}
+	return os.Rename(archivePath+".tmp", archivePath)
+}
+
+func addFileToArchive(tw *tar.Writer, path string, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(stat, "")
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(name)
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func listBackups(dir string) ([]BackupInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []BackupInfo{}, nil
+		}
+		return nil, err
+	}
+	backups := []BackupInfo{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), backupExtension) {
+			continue
+		}
+		info, err := backupInfo(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, info)
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		if backups[i].CreatedAt != backups[j].CreatedAt {
+			return backups[i].CreatedAt > backups[j].CreatedAt
+		}
+		return backups[i].seq > backups[j].seq
+	})
+	return backups, nil
+}
+
+// backupInfo reads the device and time a backup was taken from its name
+func backupInfo(path string) (BackupInfo, error) {
+	name := filepath.Base(path)
+	device, timestamp, ok := strings.Cut(strings.TrimSuffix(name, backupExtension), "_")
+	if !ok {
+		return BackupInfo{}, fmt.Errorf("%s isn't a backup", name)
+	}
+	seq := 1
+	if stamp, suffix, ok := strings.Cut(timestamp, "-"); ok {
+		n, err := strconv.Atoi(suffix)
+		if err != nil || n < 2 {
+			return BackupInfo{}, fmt.Errorf("%s isn't a backup", name)
+		}
+		timestamp, seq = stamp, n
+	}
+	createdAt, err := time.Parse(backupTimestampLayout, timestamp)
+	if err != nil {
+		return BackupInfo{}, fmt.Errorf("%s isn't a backup", name)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	return BackupInfo{
+		Name:      name,
+		Path:      path,
+		Device:    device,
+		CreatedAt: createdAt.Format(time.RFC3339),
+		Size:      stat.Size(),
+		seq:       seq,
+	}, nil
+}
+
+// pruneBackups removes all but the newest backups of a device
+func pruneBackups(dir string, device string, retention int, logger *slog.Logger) error {
+	// Keeping zero backups wouldn't make sense so it means that nothing is ever pruned
+	if retention <= 0 {
+		return nil
+	}
+	backups, err := listBackups(dir)
+	if err != nil {
+		return err
+	}
+	kept := 0
+	for _, backup := range backups {
+		if backup.Device != device {
+			continue
+		}
+		kept++
+		if kept <= retention {
+			continue
+		}
+		logger.Info("Removing old backup",
+			slog.String("backup", backup.Path),
+		)
+		if err := os.Remove(backup.Path); err != nil {
+			return fmt.Errorf("failed to remove old backup: %w", err)
+		}
+	}
+	return nil
+}
+
+func restoreBackup(backupsDir string, name string, dest string, logger *slog.Logger) error {
+	if name != filepath.Base(name) {
+		return fmt.Errorf("%q isn't the name of a backup", name)
+	}
+	f, err := os.Open(filepath.Join(backupsDir, name))
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+		if !filepath.IsLocal(header.Name) {
+			return fmt.Errorf("backup contains a file outside of the device: %s", header.Name)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		target := filepath.Join(dest, filepath.FromSlash(header.Name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", header.Name, err)
+		}
+		_, err = io.Copy(out, tr)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", header.Name, err)
+		}
+	}
+	logger.Info("Restored backup",
+		slog.String("backup", name),
+		slog.String("destination", dest),
+	)
+	return nil
+}
+
+// backupDeviceName is the part of a backup's name that says which device it came from
+func backupDeviceName(kb Kobo) string {
+	if kb.Serial == "" {
+		return "local"
+	}
+	return unsafeBackupChars.ReplaceAllString(kb.Serial, "-")
+}
@@ -0,0 +1,137 @@
+package backend
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateBackup_RoundTrip(t *testing.T) {
+	dbPath := setupFixtureDB(t)
+	mount := setupTmpKobo(t.TempDir(), libraTwoDeviceId)
+	markups := filepath.Join(mount, ".kobo", "markups")
+	assert.NoError(t, os.MkdirAll(markups, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(markups, "b1000000.svg"), []byte("<svg/>"), 0644))
+	kb := GetKoboMetadata([]string{mount}, slog.New(&discardHandler{}))[0]
+	kb.DbPath = dbPath
+	dir := t.TempDir()
+	logger := slog.New(&discardHandler{})
+
+	info, err := createBackup(kb, dir, 0, time.Date(2023, 3, 2, 21, 0, 0, 0, time.UTC), logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "NXXXXXXXXXX_20230302T210000Z.tar.gz", info.Name)
+	assert.Equal(t, "NXXXXXXXXXX", info.Device)
+	assert.Equal(t, "2023-03-02T21:00:00Z", info.CreatedAt)
+
+	restored := t.TempDir()
+	assert.NoError(t, restoreBackup(dir, info.Name, restored, logger))
+	svg, err := os.ReadFile(filepath.Join(restored, ".kobo", "markups", "b1000000.svg"))
+	assert.NoError(t, err)
+	assert.Equal(t, "<svg/>", string(svg))
+	_, err = os.Stat(filepath.Join(restored, ".kobo", "version"))
+	assert.NoError(t, err)
+
+	b := setupTestBackend(t, "")
+	assert.NoError(t, b.SelectLocalKobo(filepath.Join(restored, ".kobo", "KoboReader.sqlite"), restored))
+	assert.Equal(t, "NXXXXXXXXXX", b.SelectedKobo.Serial)
+	records, err := b.ExportHighlights()
+	assert.NoError(t, err)
+	assert.Len(t, records, 4)
+
+	// Restoring never overwrites what is already there
+	assert.ErrorContains(t, restoreBackup(dir, info.Name, restored, logger), "file exists")
+	assert.ErrorContains(t, restoreBackup(dir, "../"+info.Name, restored, logger), "isn't the name of a backup")
+}
+
+func TestCreateBackup_Retention(t *testing.T) {
+	dbPath := setupFixtureDB(t)
+	dir := t.TempDir()
+	logger := slog.New(&discardHandler{})
+	start := time.Date(2023, 3, 2, 21, 0, 0, 0, time.UTC)
+	other := Kobo{DbPath: dbPath, Serial: "N506"}
+	_, err := createBackup(other, dir, 2, start, logger)
+	assert.NoError(t, err)
+	local := Kobo{DbPath: dbPath, MntPath: dbPath}
+	for i := 0; i < 3; i++ {
+		_, err := createBackup(local, dir, 2, start.Add(time.Duration(i)*time.Hour), logger)
+		assert.NoError(t, err)
+	}
+
+	backups, err := listBackups(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, backup := range backups {
+		names = append(names, backup.Name)
+	}
+	assert.Equal(t, []string{
+		"local_20230302T230000Z.tar.gz",
+		"local_20230302T220000Z.tar.gz",
+		"N506_20230302T210000Z.tar.gz",
+	}, names)
+}
+
+func TestCreateBackup_MissingDatabase(t *testing.T) {
+	dir := t.TempDir()
+	_, err := createBackup(Kobo{DbPath: filepath.Join(dir, "missing.sqlite")}, dir, 0, time.Now(), slog.New(&discardHandler{}))
+	assert.ErrorContains(t, err, "failed to find kobo database to back up")
+	backups, err := listBackups(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, backups)
+}
+
+func TestCreateBackup_SameSecond(t *testing.T) {
+	dbPath := setupFixtureDB(t)
+	dir := t.TempDir()
+	logger := slog.New(&discardHandler{})
+	now := time.Date(2023, 3, 2, 21, 0, 0, 0, time.UTC)
+	local := Kobo{DbPath: dbPath, MntPath: dbPath}
+	var created []string
+	for i := 0; i < 3; i++ {
+		info, err := createBackup(local, dir, 0, now.Add(time.Duration(i)*time.Millisecond), logger)
+		assert.NoError(t, err)
+		assert.Equal(t, "2023-03-02T21:00:00Z", info.CreatedAt)
+		created = append(created, info.Name)
+	}
+	assert.Equal(t, []string{
+		"local_20230302T210000Z.tar.gz",
+		"local_20230302T210000Z-2.tar.gz",
+		"local_20230302T210000Z-3.tar.gz",
+	}, created)
+
+	backups, err := listBackups(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, backup := range backups {
+		names = append(names, backup.Name)
+	}
+	assert.Equal(t, []string{
+		"local_20230302T210000Z-3.tar.gz",
+		"local_20230302T210000Z-2.tar.gz",
+		"local_20230302T210000Z.tar.gz",
+	}, names)
+
+	// Retention treats the newest of them as the ones to keep
+	assert.NoError(t, pruneBackups(dir, "local", 1, logger))
+	backups, err = listBackups(dir)
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+	assert.Equal(t, "local_20230302T210000Z-3.tar.gz", backups[0].Name)
+}
+
+func TestSnapshotDatabase_UnusualPath(t *testing.T) {
+	fixture, err := os.ReadFile(setupFixtureDB(t))
+	assert.NoError(t, err)
+	// ? and # would otherwise be read as the start of the URI's query and fragment
+	dir := filepath.Join(t.TempDir(), "Kobo? #1")
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	dbPath := filepath.Join(dir, "KoboReader.sqlite")
+	assert.NoError(t, os.WriteFile(dbPath, fixture, 0644))
+
+	dest := filepath.Join(t.TempDir(), "snapshot.sqlite")
+	assert.NoError(t, snapshotDatabase(dbPath, dest))
+	assert.FileExists(t, dest)
+}
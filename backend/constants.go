@@ -1,7 +1,16 @@
 package backend
 
 var (
-	configFilename  = "october/config.json"
-	MaxHighlightLen = 8096 // It's actually 8191 but we'll go under the limit anyway
-	UserAgentFmt    = "noctober/%s <https://github.com/LGUG2Z/noctober>"
+	configFilename      = "october/config.json"
+	syncStateFilename   = "october/sync_state.json"
+	MaxHighlightLen     = 8096 // It's actually 8191 but we'll go under the limit anyway
+	UserAgentFmt        = "noctober/%s <https://github.com/LGUG2Z/noctober>"
+	NotadoEndpointEnv   = "NOTADO_ENDPOINT"
+	ReadwiseEndpointEnv = "READWISE_ENDPOINT"
+)
+
+const (
+	NotadoDestinationName   = "notado"
+	MarkdownDestinationName = "markdown"
+	ReadwiseDestinationName = "readwise"
 )
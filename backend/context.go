@@ -0,0 +1,199 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/xml"
+	"log/slog"
+	"math"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/marcus-crane/october/v2/pkg/epub"
+)
+
+// MaxContextLength keeps the context around a highlight to a few paragraphs at most
+const MaxContextLength = 1000
+
+// koboOnboardPrefix is how Kobo refers to the root of the device's storage in a VolumeID
+const koboOnboardPrefix = "file:///mnt/onboard/"
+
+// resolveContext fills in the text surrounding each highlight when the user has asked for it
+func (b *Backend) resolveContext(bookmarks []Bookmark) {
+	if b.Settings.ContextLength <= 0 {
+		return
+	}
+	resolveContext(bookmarks, b.SelectedKobo.MntPath, b.Settings.ContextLength, b.logger)
+}
+
+// resolveContext prefers the context that Kobo stored alongside a highlight and otherwise reads
+// it from the book itself, which is only possible for sideloaded books. Highlights whose text
+// can't be found are left without any context.
+func resolveContext(bookmarks []Bookmark, mntPath string, length int, logger *slog.Logger) {
+	chapters := map[string]string{}
+	for i, bookmark := range bookmarks {
+		if NormaliseText(bookmark.Text) == "" {
+			continue
+		}
+		if bookmark.ContextString != "" {
+			bookmarks[i].Context = surroundingText(bookmark.ContextString, bookmark.Text, length, 0.5)
+			if bookmarks[i].Context != "" {
+				continue
+			}
+		}
+		bookPath, ok := bookFilePath(mntPath, bookmark.VolumeID)
+		if !ok {
+			continue
+		}
+		file := chapterFile(bookmark.VolumeID, bookmark.ContentID)
+		key := bookmark.VolumeID + "\x00" + file
+		passage, ok := chapters[key]
+		if !ok {
+			data, err := epub.ReadFile(bookPath, file)
+			if err != nil {
+				logger.Warn("Failed to read chapter from book so highlights in it won't have context",
+					slog.String("error", err.Error()),
+					slog.String("volume_id", bookmark.VolumeID),
+					slog.String("chapter", file),
+				)
+			} else {
+				passage = htmlText(data)
+			}
+			chapters[key] = passage
+		}
+		bookmarks[i].Context = surroundingText(passage, bookmark.Text, length, bookmark.ChapterProgress)
+	}
+}
+
+// bookFilePath finds a sideloaded book on the device. Store bought books are encrypted so they
+// are never read.
+func bookFilePath(mntPath string, volumeID string) (string, bool) {
+	relative, ok := strings.CutPrefix(volumeID, koboOnboardPrefix)
+	if !ok || mntPath == "" {
+		return "", false
+	}
+	path := filepath.Join(mntPath, filepath.FromSlash(relative))
+	return path, isFile(path)
+}
+
+// surroundingText returns the highlighted text with up to length characters either side of it
+// from passage, stopping at whole words. When the text appears more than once, progress picks
+// the appearance closest to how far through the passage the highlight was made.
+func surroundingText(passage string, text string, length int, progress float64) string {
+	passage = strings.Join(strings.Fields(passage), " ")
+	text = strings.Join(strings.Fields(text), " ")
+	if passage == "" || text == "" {
+		return ""
+	}
+	target := progress * float64(len(passage))
+	start := -1
+	for offset := 0; ; {
+		i := strings.Index(passage[offset:], text)
+		if i == -1 {
+			break
+		}
+		if start == -1 || math.Abs(float64(offset+i)-target) < math.Abs(float64(start)-target) {
+			start = offset + i
+		}
+		offset += i + 1
+	}
+	if start == -1 {
+		return ""
+	}
+	before := []rune(passage[:start])
+	after := []rune(passage[start+len(text):])
+	if len(before) == 0 && len(after) == 0 {
+		return ""
+	}
+	leading := string(before[max(len(before)-length, 0):])
+	if len(before) > length {
+		// A word that was cut in half is dropped
+		if !unicode.IsSpace(before[len(before)-length-1]) {
+			if i := strings.IndexFunc(leading, unicode.IsSpace); i != -1 {
+				leading = leading[i:]
+			}
+		}
+		leading = "…" + strings.TrimLeftFunc(leading, unicode.IsSpace)
+	}
+	trailing := string(after[:min(length, len(after))])
+	if len(after) > length {
+		if !unicode.IsSpace(after[length]) {
+			if i := strings.LastIndexFunc(trailing, unicode.IsSpace); i != -1 {
+				trailing = trailing[:i]
+			}
+		}
+		trailing = strings.TrimRightFunc(trailing, unicode.IsSpace) + "…"
+	}
+	return leading + text + trailing
+}
+
+// markHighlight returns context with the highlighted text inside it picked out in bold, for
+// destinations that have nowhere to put the context except alongside the highlight. Context
+// built by surroundingText has roughly as much text either side of the highlight so the
+// appearance closest to the middle is the one that was highlighted.
+func markHighlight(context string, text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return context
+	}
+	middle := float64(len(context)-len(text)) / 2
+	start := -1
+	for offset := 0; ; {
+		i := strings.Index(context[offset:], text)
+		if i == -1 {
+			break
+		}
+		if start == -1 || math.Abs(float64(offset+i)-middle) < math.Abs(float64(start)-middle) {
+			start = offset + i
+		}
+		offset += i + 1
+	}
+	if start == -1 {
+		return text
+	}
+	return context[:start] + "**" + text + "**" + context[start+len(text):]
+}
+
+// htmlBlockElements separate words even when there is no whitespace between them in the markup
+var htmlBlockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "blockquote": true, "section": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "tr": true, "td": true,
+}
+
+// htmlText extracts the readable text from a chapter. Chapters are usually XHTML but plain HTML
+// is accepted too.
+func htmlText(data []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+	var b strings.Builder
+	skipping := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch name := strings.ToLower(t.Name.Local); {
+			case name == "head" || name == "script" || name == "style":
+				skipping++
+			case htmlBlockElements[name]:
+				b.WriteString(" ")
+			}
+		case xml.EndElement:
+			switch name := strings.ToLower(t.Name.Local); {
+			case name == "head" || name == "script" || name == "style":
+				skipping = max(skipping-1, 0)
+			case htmlBlockElements[name]:
+				b.WriteString(" ")
+			}
+		case xml.CharData:
+			if skipping == 0 {
+				b.Write(t)
+			}
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,141 @@
+package backend
+
+import (
+	"archive/zip"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marcus-crane/october/backend/notadotest"
+	"github.com/marcus-crane/october/v2/pkg/epub"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestEpub creates a minimal epub holding a single chapter at OEBPS/chapter1.html
+func writeTestEpub(t *testing.T, path string, chapter string) {
+	t.Helper()
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	zw := zip.NewWriter(f)
+	files := []struct {
+		name string
+		body string
+	}{
+		{"mimetype", "application/epub+zip"},
+		{"META-INF/container.xml", `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`},
+		{"OEBPS/content.opf", `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata><title>Emma</title></metadata>
+  <manifest><item id="chapter1" href="chapter1.html" media-type="application/xhtml+xml"/></manifest>
+  <spine><itemref idref="chapter1"/></spine>
+</package>`},
+		{"OEBPS/chapter1.html", chapter},
+	}
+	for _, file := range files {
+		w, err := zw.Create(file.name)
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(file.body))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	assert.NoError(t, f.Close())
+}
+
+func TestSurroundingText(t *testing.T) {
+	passage := "I must not fear. Fear is the mind-killer. Fear is the little-death that brings total obliteration."
+	assert.Equal(t, "…not fear. Fear is the mind-killer. Fear is the…", surroundingText(passage, "Fear is the\nmind-killer.", 12, 0.5))
+	assert.Equal(t, passage, surroundingText(passage, "Fear is the mind-killer.", 100, 0.5))
+	// A highlight that appears more than once is found nearest to where it was made
+	assert.Equal(t, "…not fear. Fear is the…", surroundingText(passage, "Fear is the", 10, 0))
+	assert.Equal(t, "…mind-killer. Fear is the little-death…", surroundingText(passage, "Fear is the", 14, 1))
+	// There is nothing to add when the highlight is all there is or it can't be found
+	assert.Empty(t, surroundingText("Fear is the mind-killer.", "Fear is the mind-killer.", 20, 0.5))
+	assert.Empty(t, surroundingText(passage, "Muad'Dib", 20, 0.5))
+}
+
+func TestHTMLText(t *testing.T) {
+	chapter := `<?xml version="1.0" encoding="utf-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>Chapter I</title><style>p { margin: 0 }</style></head>
+<body><h1>Chapter I</h1><p><span class="koboSpan" id="kobo.1.1">Emma Woodhouse, handsome, clever, and rich,</span> <span class="koboSpan" id="kobo.1.2">with a comfortable home&nbsp;&amp; happy disposition</span></p><p>seemed to unite</p></body>
+</html>`
+	assert.Equal(t, "Chapter I Emma Woodhouse, handsome, clever, and rich, with a comfortable home & happy disposition seemed to unite", htmlText([]byte(chapter)))
+}
+
+func TestExportHighlights_Context(t *testing.T) {
+	b := setupTestBackend(t, "")
+	mount := t.TempDir()
+	b.SelectedKobo.MntPath = mount
+	writeTestEpub(t, filepath.Join(mount, "Austen, Jane", "Emma - Jane Austen.epub"),
+		`<html><body><p>Emma Woodhouse, handsome, clever, and rich, with a comfortable home and happy disposition, seemed to unite some of the best blessings of existence</p></body></html>`)
+
+	records, err := b.ExportHighlights()
+	assert.NoError(t, err)
+	for _, record := range records {
+		assert.Empty(t, record.Context)
+	}
+
+	assert.NoError(t, b.Settings.SaveContextLength(30))
+	records, err = b.ExportHighlights()
+	assert.NoError(t, err)
+	contexts := map[string]string{}
+	for _, record := range records {
+		contexts[record.BookmarkID] = record.Context
+	}
+	// Kobo stored the context for the first highlight while the second is read from the book
+	assert.Equal(t, "I must not fear. Fear is the mind-killer. Fear is the little-death that…", contexts["b1000000-0000-0000-0000-000000000001"])
+	assert.Equal(t, "Emma Woodhouse, handsome, clever, and rich, with a comfortable home and…", contexts["b1000000-0000-0000-0000-000000000004"])
+	// Store bought books are encrypted so there is nowhere to read their context from
+	assert.Empty(t, contexts["b1000000-0000-0000-0000-000000000005"])
+}
+
+func TestMarkHighlight(t *testing.T) {
+	assert.Equal(t, "…not fear. **Fear is the mind-killer.** Fear is the…", markHighlight("…not fear. Fear is the mind-killer. Fear is the…", "Fear is the\nmind-killer."))
+	// A highlight that appears more than once in its context is the one in the middle
+	assert.Equal(t, "…not fear. **Fear is the** mind-killer. Fear is the…", markHighlight("…not fear. Fear is the mind-killer. Fear is the…", "Fear is the"))
+	assert.Equal(t, "mind-killer", markHighlight("Fear is the little-death.", "mind-killer"))
+}
+
+func TestBuildPayload_IncludesContext(t *testing.T) {
+	bookmarks := []Bookmark{
+		{BookmarkID: "a", VolumeID: "file:///mnt/onboard/dune.epub", Text: "mind-killer", Context: "Fear is the mind-killer.", DateCreated: "2023-03-02T21:00:00.000"},
+	}
+	payload, err := BuildPayload(bookmarks, map[string]Content{}, slog.New(&discardHandler{}))
+	assert.NoError(t, err)
+	assert.Equal(t, "Fear is the **mind-killer**.", payload[0].Highlights[0].Content)
+}
+
+func TestEpubReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "emma.epub")
+	writeTestEpub(t, path, "<p>Emma Woodhouse</p>")
+	// Chapters can be named from the root of the epub or from its package file
+	for _, name := range []string{"OEBPS/chapter1.html", "chapter1.html"} {
+		data, err := epub.ReadFile(path, name)
+		assert.NoError(t, err)
+		assert.Equal(t, "<p>Emma Woodhouse</p>", string(data))
+	}
+	_, err := epub.ReadFile(path, "chapter2.html")
+	assert.Error(t, err)
+}
+
+func TestForwardToNotado_IncludesContext(t *testing.T) {
+	server := notadotest.NewServer()
+	defer server.Close()
+	b := setupTestBackend(t, server.Endpoint())
+	assert.NoError(t, b.Settings.SaveContextLength(30))
+
+	_, err := b.ForwardToNotado()
+	assert.NoError(t, err)
+	var contents []string
+	for _, note := range server.Notes() {
+		contents = append(contents, note.Content)
+	}
+	assert.Contains(t, contents, "**I must not fear. Fear is the mind-killer.** Fear is the little-death that…")
+}
@@ -1,6 +1,10 @@
 package backend
 
 import (
+	"net/url"
+	"path/filepath"
+	"strings"
+
 	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
 )
@@ -15,3 +19,20 @@ func OpenConnection(filepath string) error {
 	Conn = conn
 	return nil
 }
+
+// readOnlyDSN builds a SQLite URI that opens the database at path without ever writing to it.
+// Building it as a URL escapes characters such as ? and # that SQLite would otherwise read as
+// the start of the query or fragment.
+func readOnlyDSN(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	abs = filepath.ToSlash(abs)
+	// Windows paths start with a drive letter which has to follow a slash, as in file:///C:/...
+	if !strings.HasPrefix(abs, "/") {
+		abs = "/" + abs
+	}
+	dsn := url.URL{Scheme: "file", Path: abs, RawQuery: "mode=ro"}
+	return dsn.String(), nil
+}
@@ -0,0 +1,187 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Destination is somewhere that highlights can be sent to, such as Notado or a folder on disc.
+// Each sync run sends the highlights that a destination hasn't seen yet to every destination
+// that has been enabled in Settings.
+type Destination interface {
+	Name() string
+	// Validate checks that a destination is configured well enough to attempt a sync
+	Validate() error
+	Send(ctx context.Context, highlights []Highlight) SyncResult
+}
+
+// WholeBookDestination is implemented by destinations that rewrite everything they hold about
+// a book at once, such as file exports. Whenever any highlight in a book is new or has changed,
+// they are sent every highlight from that book rather than only the ones that changed.
+type WholeBookDestination interface {
+	Destination
+	SendsWholeBooks() bool
+}
+
+// SyncResult describes the outcome of sending highlights to a single destination
+type SyncResult struct {
+	Destination      string        `json:"destination"`
+	Sent             int           `json:"sent"`
+	Batches          []BatchResult `json:"batches,omitempty"`
+	FirstFailedBatch int           `json:"first_failed_batch"`
+	Error            string        `json:"error,omitempty"`
+	Books            []BookResult  `json:"books,omitempty"`
+	// Orphaned lists highlights sent here before that have since been deleted on the device
+	Orphaned []OrphanedHighlight `json:"orphaned,omitempty"`
+	// Err retains the original error so that callers can inspect its type
+	Err error `json:"-"`
+	// Synced lists the bookmarks that made it to the destination when a sync partially fails
+	Synced []string `json:"-"`
+}
+
+// BookResult counts how many of a book's pending highlights made it to a destination
+type BookResult struct {
+	Title      string `json:"title"`
+	Author     string `json:"author"`
+	Highlights int    `json:"highlights"`
+	Synced     int    `json:"synced"`
+}
+
+// bookResults tallies pending and synced bookmarks by book, in the order that books were sent
+func bookResults(pending []Bookmark, synced []Bookmark, contentIndex map[string]Content) []BookResult {
+	var results []BookResult
+	index := map[string]int{}
+	for _, bookmark := range pending {
+		i, ok := index[bookmark.VolumeID]
+		if !ok {
+			book := contentIndex[bookmark.VolumeID]
+			i = len(results)
+			index[bookmark.VolumeID] = i
+			results = append(results, BookResult{Title: book.Title, Author: book.Attribution})
+		}
+		results[i].Highlights++
+	}
+	for _, bookmark := range synced {
+		results[index[bookmark.VolumeID]].Synced++
+	}
+	return results
+}
+
+// DestinationFactory constructs a destination using the settings and clients held by the backend
+type DestinationFactory func(b *Backend) Destination
+
+// DestinationStatus describes a registered destination for display in the GUI
+type DestinationStatus struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+var destinationFactories = map[string]DestinationFactory{}
+
+// RegisterDestination makes a destination available to be enabled in Settings. It is intended
+// to be called from an init function in the file that implements the destination.
+func RegisterDestination(name string, factory DestinationFactory) {
+	if _, exists := destinationFactories[name]; exists {
+		panic(fmt.Sprintf("destination %q registered twice", name))
+	}
+	destinationFactories[name] = factory
+}
+
+// AvailableDestinations returns the names of every registered destination in alphabetical order
+func AvailableDestinations() []string {
+	var names []string
+	for name := range destinationFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func failedSyncResult(destination string, err error) SyncResult {
+	return SyncResult{
+		Destination:      destination,
+		FirstFailedBatch: -1,
+		Error:            err.Error(),
+		Err:              err,
+	}
+}
+
+func (b *Backend) ListDestinations() []DestinationStatus {
+	enabled := map[string]bool{}
+	for _, name := range b.Settings.Destinations {
+		enabled[name] = true
+	}
+	statuses := []DestinationStatus{}
+	for _, name := range AvailableDestinations() {
+		statuses = append(statuses, DestinationStatus{
+			Name:    name,
+			Enabled: enabled[name],
+		})
+	}
+	return statuses
+}
+
+func (b *Backend) enabledDestinations() ([]Destination, error) {
+	return b.namedDestinations(b.Settings.Destinations)
+}
+
+// namedDestinations builds the destinations with the given names, in the order given
+func (b *Backend) namedDestinations(names []string) ([]Destination, error) {
+	var destinations []Destination
+	for _, name := range names {
+		factory, ok := destinationFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown destination %q. available destinations are %v", name, AvailableDestinations())
+		}
+		destinations = append(destinations, factory(b))
+	}
+	if len(destinations) == 0 {
+		return nil, fmt.Errorf("no destinations are enabled so there is nowhere to send highlights")
+	}
+	return destinations, nil
+}
+
+// expandToWholeBooks returns every bookmark belonging to a book that has at least one pending bookmark
+func expandToWholeBooks(pending []Bookmark, bookmarks []Bookmark) []Bookmark {
+	changedBooks := map[string]bool{}
+	for _, bookmark := range pending {
+		changedBooks[bookmark.VolumeID] = true
+	}
+	var expanded []Bookmark
+	for _, bookmark := range bookmarks {
+		if changedBooks[bookmark.VolumeID] {
+			expanded = append(expanded, bookmark)
+		}
+	}
+	return expanded
+}
+
+// uniqueHighlights drops the extra chunks of highlights that were split up to fit within
+// Notado's length limit, for destinations that would rather have the whole highlight
+func uniqueHighlights(highlights []Highlight) []Highlight {
+	seen := map[string]bool{}
+	var unique []Highlight
+	for _, highlight := range highlights {
+		if seen[highlight.BookmarkID] {
+			continue
+		}
+		seen[highlight.BookmarkID] = true
+		unique = append(unique, highlight)
+	}
+	return unique
+}
+
+// sortByPosition orders highlights by where they appear within their book
+func sortByPosition(highlights []Highlight) {
+	sort.SliceStable(highlights, func(i, j int) bool {
+		return highlightPosition(highlights[i]) < highlightPosition(highlights[j])
+	})
+}
+
+func highlightPosition(highlight Highlight) float64 {
+	if highlight.Bookmark == nil {
+		return 0
+	}
+	return highlight.Bookmark.Position
+}
@@ -1,19 +1,29 @@
 package backend
 
 import (
+	"database/sql"
 	"fmt"
 	"log/slog"
+	"math"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/pgaskin/koboutils/v2/kobo"
+	"gorm.io/gorm"
 )
 
 type Kobo struct {
-	Name       string `json:"name"`
-	Storage    int    `json:"storage"`
-	DisplayPPI int    `json:"display_ppi"`
-	MntPath    string `json:"mnt_path"`
-	DbPath     string `json:"db_path"`
+	Name            string `json:"name"`
+	Storage         int    `json:"storage"`
+	DisplayPPI      int    `json:"display_ppi"`
+	MntPath         string `json:"mnt_path"`
+	DbPath          string `json:"db_path"`
+	Serial          string `json:"serial"`
+	FirmwareVersion string `json:"firmware_version"`
+	DeviceID        string `json:"device_id"`
 }
 
 type HighlightCounts struct {
@@ -143,7 +153,81 @@ type Bookmark struct {
 	SyncTime                 string
 	Published                string
 	ContextString            string
-	Type                     string
+	Type                     BookmarkType
+	// The chapter a bookmark was made in isn't stored alongside it so these are filled in
+	// from the chapter index after the bookmarks are read. ChapterIndex is -1 when unknown.
+	ChapterTitle string `gorm:"-" json:"chapter_title"`
+	ChapterIndex int    `gorm:"-" json:"chapter_index"`
+	// BookProgress is how far through the whole book a bookmark is as a percentage, which
+	// ChapterProgress alone can't tell you, or -1 when the chapter is unknown. Position orders
+	// bookmarks within a book and is the chapter index plus the progress through that chapter
+	// so it doesn't rely on file sizes.
+	BookProgress float64 `gorm:"-" json:"book_progress"`
+	Position     float64 `gorm:"-" json:"position"`
+	// Colour is only known on firmware that supports coloured highlights. Older databases
+	// don't have the column at all so it is read separately rather than by gorm.
+	Colour HighlightColour `gorm:"-" json:"colour"`
+	// MarkupPath is where the image of a handwritten markup was rendered to, if it has one
+	MarkupPath string `gorm:"-" json:"markup_path"`
+	// Context is the text surrounding a highlight, when the user has asked for it
+	Context string `gorm:"-" json:"context"`
+}
+
+// BookmarkType is the kind of mark a reader left, as stored in the Type column
+type BookmarkType string
+
+const (
+	BookmarkTypeHighlight BookmarkType = "highlight"
+	BookmarkTypeNote      BookmarkType = "note"
+	BookmarkTypeDogear    BookmarkType = "dogear"
+	BookmarkTypeMarkup    BookmarkType = "markup"
+)
+
+// HighlightColour is the colour a reader picked for a highlight. It is empty for firmware
+// that predates coloured highlights.
+type HighlightColour string
+
+const (
+	HighlightColourYellow HighlightColour = "yellow"
+	HighlightColourPink   HighlightColour = "pink"
+	HighlightColourBlue   HighlightColour = "blue"
+	HighlightColourGreen  HighlightColour = "green"
+)
+
+// HighlightColours are in the order that Kobo numbers them in the Color column
+var HighlightColours = []HighlightColour{HighlightColourYellow, HighlightColourPink, HighlightColourBlue, HighlightColourGreen}
+
+// DefaultBookmarkTypes are synced unless a user picks otherwise. Dogears are only ever
+// exported as page markers since they have no text to send anywhere.
+var DefaultBookmarkTypes = []BookmarkType{BookmarkTypeHighlight, BookmarkTypeNote, BookmarkTypeMarkup}
+
+// AllBookmarkTypes lists every type that Kobo is known to store
+var AllBookmarkTypes = []BookmarkType{BookmarkTypeHighlight, BookmarkTypeNote, BookmarkTypeDogear, BookmarkTypeMarkup}
+
+// bookmarkTypeExpr works out a bookmark's type in SQL. Older firmware leaves the Type column
+// empty so the type is inferred from what the bookmark holds, the same way as kind does.
+const bookmarkTypeExpr = `CASE
+	WHEN Type IS NOT NULL AND Type != '' THEN Type
+	WHEN Annotation IS NOT NULL AND Annotation != '' THEN 'note'
+	WHEN Text IS NOT NULL AND Text != '' THEN 'highlight'
+	ELSE 'dogear'
+END`
+
+// bookmarkHiddenExpr matches bookmarks that were deleted on the device. Kobo keeps these around
+// with Hidden set, which has been stored as both text and a number over the years.
+const bookmarkHiddenExpr = `LOWER(CAST(Hidden AS TEXT)) IN ('true', '1')`
+
+// kind returns the bookmark's type, inferring it for firmware that doesn't record one
+func (b Bookmark) kind() BookmarkType {
+	switch {
+	case b.Type != "":
+		return b.Type
+	case b.Annotation != "":
+		return BookmarkTypeNote
+	case b.Text != "":
+		return BookmarkTypeHighlight
+	}
+	return BookmarkTypeDogear
 }
 
 func (Content) TableName() string {
@@ -157,7 +241,7 @@ func (Bookmark) TableName() string {
 func GetKoboMetadata(detectedPaths []string, logger *slog.Logger) []Kobo {
 	var kobos []Kobo
 	for _, path := range detectedPaths {
-		_, _, deviceId, err := kobo.ParseKoboVersion(path)
+		serial, version, deviceId, err := kobo.ParseKoboVersion(path)
 		if err != nil {
 			logger.Error("Failed to parse Kobo version",
 				slog.String("error", err.Error()),
@@ -166,44 +250,82 @@ func GetKoboMetadata(detectedPaths []string, logger *slog.Logger) []Kobo {
 		}
 		logger.Info("Found attached device",
 			slog.String("device_id", deviceId),
+			slog.String("firmware_version", version),
 			slog.String("kobo_path", path),
 		)
+		detected := Kobo{
+			MntPath:         path,
+			DbPath:          fmt.Sprintf("%s/.kobo/KoboReader.sqlite", path),
+			Serial:          serial,
+			FirmwareVersion: version,
+			DeviceID:        deviceId,
+		}
 		device, found := kobo.DeviceByID(deviceId)
 		if found {
-			kobos = append(kobos, Kobo{
-				Name:       device.Name(),
-				Storage:    device.StorageGB(),
-				DisplayPPI: device.DisplayPPI(),
-				MntPath:    path,
-				DbPath:     fmt.Sprintf("%s/.kobo/KoboReader.sqlite", path),
-			})
+			detected.Name = device.Name()
+			detected.Storage = device.StorageGB()
+			detected.DisplayPPI = device.DisplayPPI()
+			kobos = append(kobos, detected)
 			continue
 		}
 		fallbackSkus := getFallbackSkus()
 		deviceIdBits := strings.Split(deviceId, ",")
 		deviceIdGuid := deviceIdBits[len(deviceIdBits)-1]
 		if fallback, ok := fallbackSkus[deviceIdGuid]; ok {
-			kobos = append(kobos, Kobo{
-				Name:       fallback.Name,
-				Storage:    fallback.Storage,
-				DisplayPPI: fallback.DisplayPPI,
-				MntPath:    path,
-				DbPath:     fmt.Sprintf("%s/.kobo/KoboReader.sqlite", path),
-			})
+			detected.Name = fallback.Name
+			detected.Storage = fallback.Storage
+			detected.DisplayPPI = fallback.DisplayPPI
+			kobos = append(kobos, detected)
 			continue
 		}
 		logger.Warn("Found a device that isn't officially supported but will likely still operate just fine",
 			slog.String("device_id", deviceId),
 		)
 		// We can handle unsupported Kobos in future but at present, there are none
-		kobos = append(kobos, Kobo{
-			MntPath: path,
-			DbPath:  fmt.Sprintf("%s/.kobo/KoboReader.sqlite", path),
-		})
+		kobos = append(kobos, detected)
 	}
 	return kobos
 }
 
+// FindKobo picks out the kobo that query refers to by its serial, mount path or name.
+// Names are only used when they are unambiguous as households often have several of the same model.
+func FindKobo(kobos []Kobo, query string) (Kobo, error) {
+	for _, kb := range kobos {
+		if kb.Serial != "" && strings.EqualFold(kb.Serial, query) {
+			return kb, nil
+		}
+		if filepath.Clean(kb.MntPath) == filepath.Clean(query) {
+			return kb, nil
+		}
+	}
+	var named []Kobo
+	for _, kb := range kobos {
+		if kb.Name != "" && strings.EqualFold(kb.Name, query) {
+			named = append(named, kb)
+		}
+	}
+	switch len(named) {
+	case 0:
+		return Kobo{}, fmt.Errorf("no connected kobo has the serial, mount path or name %q", query)
+	case 1:
+		return named[0], nil
+	}
+	var serials []string
+	for _, kb := range named {
+		serials = append(serials, kb.Serial)
+	}
+	return Kobo{}, fmt.Errorf("%d connected kobos are named %q. pick one by serial instead: %s", len(named), query, strings.Join(serials, ", "))
+}
+
+// identifier returns the most stable way of telling this device apart from others, which is
+// its serial number when known. Local databases fall back to their path.
+func (k *Kobo) identifier() string {
+	if k.Serial != "" {
+		return k.Serial
+	}
+	return k.MntPath
+}
+
 func (k *Kobo) ListDeviceContent(includeStoreBought bool, logger *slog.Logger) ([]Content, error) {
 	var content []Content
 	logger.Debug("Retrieving content list from device")
@@ -224,10 +346,19 @@ func (k *Kobo) ListDeviceContent(includeStoreBought bool, logger *slog.Logger) (
 	return content, nil
 }
 
-func (k *Kobo) ListDeviceBookmarks(includeStoreBought bool, logger *slog.Logger) ([]Bookmark, error) {
+// ListDeviceBookmarks returns the bookmarks of the given types, leaving out those deleted on the
+// device unless includeHidden is set. ChapterProgress is only the progress through a chapter so
+// they are in reading order once assignChapters has worked out their position.
+func (k *Kobo) ListDeviceBookmarks(includeStoreBought bool, includeHidden bool, types []BookmarkType, logger *slog.Logger) ([]Bookmark, error) {
 	var bookmarks []Bookmark
-	logger.Debug("Retrieving bookmarks from device")
-	result := Conn
+	logger.Debug("Retrieving bookmarks from device",
+		slog.Any("types", types),
+		slog.Bool("include_hidden", includeHidden),
+	)
+	result := Conn.Where(bookmarkTypeExpr+" IN ?", bookmarkTypeValues(types))
+	if !includeHidden {
+		result = result.Where("NOT " + bookmarkHiddenExpr)
+	}
 	if !includeStoreBought {
 		result = result.Where("VolumeID LIKE '%file:///%'")
 	}
@@ -238,6 +369,9 @@ func (k *Kobo) ListDeviceBookmarks(includeStoreBought bool, logger *slog.Logger)
 		)
 		return nil, result.Error
 	}
+	if err := k.assignColours(bookmarks, logger); err != nil {
+		return nil, err
+	}
 	logger.Debug("Successfully retrieved device bookmarks",
 		slog.Int("bookmark_count", len(bookmarks)),
 	)
@@ -256,18 +390,180 @@ func (k *Kobo) BuildContentIndex(content []Content, logger *slog.Logger) map[str
 	return contentIndex
 }
 
-func (k *Kobo) CountDeviceBookmarks(logger *slog.Logger) HighlightCounts {
+// ListDeviceChapters returns the content rows that make up the chapters of every book. Kobo
+// stores these as type 9 for sideloaded books and 899 for store bought ones.
+func (k *Kobo) ListDeviceChapters(logger *slog.Logger) ([]Content, error) {
+	var chapters []Content
+	logger.Debug("Retrieving chapter list from device")
+	result := Conn.Where("ContentType IN ?", []string{"9", "899"}).Order("BookID ASC, VolumeIndex ASC").Find(&chapters)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve chapters from device",
+			slog.String("error", result.Error.Error()),
+		)
+		return nil, result.Error
+	}
+	logger.Debug("Successfully retrieved device chapters",
+		slog.Int("chapter_count", len(chapters)),
+	)
+	return chapters, nil
+}
+
+// BuildChapterIndex indexes chapters by their ContentID, which is what a bookmark's ContentID
+// points at. Some firmware writes the two differently for the same file so each chapter is
+// also indexed under its book and file path as a fallback.
+func (k *Kobo) BuildChapterIndex(chapters []Content, logger *slog.Logger) map[string]Content {
+	logger.Debug("Building an index out of device chapters")
+	chapterIndex := make(map[string]Content)
+	for _, chapter := range chapters {
+		chapterIndex[chapter.ContentID] = chapter
+		// Chapters are ordered so the first table of contents entry for a file wins
+		key := chapterKey(chapter.BookID, chapter.ContentID)
+		if _, ok := chapterIndex[key]; !ok {
+			chapterIndex[key] = chapter
+		}
+	}
+	logger.Debug("Built chapter index",
+		slog.Int("index_count", len(chapterIndex)),
+	)
+	return chapterIndex
+}
+
+// chapterKey identifies a chapter by its book and the file it lives in
+func chapterKey(volumeID string, contentID string) string {
+	return volumeID + "\x00" + chapterFile(volumeID, contentID)
+}
+
+// chapterFile is the path of a chapter's file within its book, ignoring the different ways Kobo
+// has of joining the two together and the -N suffix given to table of contents entries
+func chapterFile(volumeID string, contentID string) string {
+	path := strings.ReplaceAll(chapterPath(Bookmark{VolumeID: volumeID, ContentID: contentID}), "!", "/")
+	if i := strings.LastIndex(path, "-"); i != -1 {
+		if _, err := strconv.Atoi(path[i+1:]); err == nil {
+			path = path[:i]
+		}
+	}
+	return path
+}
+
+// chapterSpan is where a chapter starts within its book and how much of the book it makes up,
+// both as fractions of the whole book
+type chapterSpan struct {
+	start float64
+	share float64
+}
+
+// chapterSpans works out the span of every chapter. Chapters are weighed by file size, or by
+// word count when sizes are missing, and are treated as the same length when neither is known.
+// Table of contents entries that point into the same file share that file's span.
+func chapterSpans(chapters []Content) map[string]chapterSpan {
+	type chapterSize struct {
+		contentIDs []string
+		size       float64
+		words      float64
+	}
+	sorted := slices.Clone(chapters)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].BookID != sorted[j].BookID {
+			return sorted[i].BookID < sorted[j].BookID
+		}
+		return sorted[i].VolumeIndex < sorted[j].VolumeIndex
+	})
+	books := map[string][]*chapterSize{}
+	files := map[string]*chapterSize{}
+	for _, chapter := range sorted {
+		key := chapterKey(chapter.BookID, chapter.ContentID)
+		file, ok := files[key]
+		if !ok {
+			words, _ := strconv.Atoi(chapter.WordCount)
+			file = &chapterSize{size: float64(chapter.FileSize), words: float64(words)}
+			files[key] = file
+			books[chapter.BookID] = append(books[chapter.BookID], file)
+		}
+		file.contentIDs = append(file.contentIDs, chapter.ContentID)
+	}
+	spans := map[string]chapterSpan{}
+	for _, bookFiles := range books {
+		weights := make([]float64, len(bookFiles))
+		for i := range weights {
+			weights[i] = 1
+		}
+		for _, measure := range []func(*chapterSize) float64{
+			func(f *chapterSize) float64 { return f.size },
+			func(f *chapterSize) float64 { return f.words },
+		} {
+			if !slices.ContainsFunc(bookFiles, func(f *chapterSize) bool { return measure(f) <= 0 }) {
+				for i, file := range bookFiles {
+					weights[i] = measure(file)
+				}
+				break
+			}
+		}
+		var total float64
+		for _, weight := range weights {
+			total += weight
+		}
+		var start float64
+		for i, file := range bookFiles {
+			span := chapterSpan{start: start / total, share: weights[i] / total}
+			for _, contentID := range file.contentIDs {
+				spans[contentID] = span
+			}
+			start += weights[i]
+		}
+	}
+	return spans
+}
+
+// assignChapters fills in the chapter and position of each bookmark and then orders them by
+// position within each book so that destinations list them the way they appear when reading
+func assignChapters(bookmarks []Bookmark, chapterIndex map[string]Content, spans map[string]chapterSpan) {
+	for i, bookmark := range bookmarks {
+		progress := min(max(bookmark.ChapterProgress, 0), 1)
+		chapter, ok := chapterIndex[bookmark.ContentID]
+		if !ok {
+			chapter, ok = chapterIndex[chapterKey(bookmark.VolumeID, bookmark.ContentID)]
+		}
+		if !ok {
+			// Without a chapter there's no telling how far through the book a bookmark is so
+			// these are listed first, in the order they appear within their own chapters
+			bookmarks[i].ChapterIndex = -1
+			bookmarks[i].BookProgress = -1
+			bookmarks[i].Position = -1 + progress
+			continue
+		}
+		bookmarks[i].ChapterTitle = strings.TrimSpace(chapter.Title)
+		bookmarks[i].ChapterIndex = chapter.VolumeIndex
+		bookmarks[i].Position = float64(chapter.VolumeIndex) + progress
+		if span, ok := spans[chapter.ContentID]; ok {
+			bookmarks[i].BookProgress = math.Round((span.start+span.share*progress)*10000) / 100
+		}
+	}
+	sort.SliceStable(bookmarks, func(i, j int) bool {
+		if bookmarks[i].VolumeID != bookmarks[j].VolumeID {
+			return bookmarks[i].VolumeID < bookmarks[j].VolumeID
+		}
+		return bookmarks[i].Position < bookmarks[j].Position
+	})
+}
+
+// CountDeviceBookmarks counts the bookmarks of the given types in db, matching what ListDeviceBookmarks
+// would return
+func (k *Kobo) CountDeviceBookmarks(db *gorm.DB, includeHidden bool, types []BookmarkType, logger *slog.Logger) HighlightCounts {
 	var totalCount int64
 	var officialCount int64
 	var sideloadedCount int64
-	result := Conn.Model(&Bookmark{}).Where("Type != 'dogear'").Count(&totalCount)
+	query := db.Model(&Bookmark{}).Where(bookmarkTypeExpr+" IN ?", bookmarkTypeValues(types))
+	if !includeHidden {
+		query = query.Where("NOT " + bookmarkHiddenExpr)
+	}
+	result := query.Session(&gorm.Session{}).Count(&totalCount)
 	if result.Error != nil {
 		logger.Error("Failed to count bookmarks on device",
 			slog.String("error", result.Error.Error()),
 		)
 	}
-	Conn.Model(&Bookmark{}).Where("VolumeID LIKE '%file:///%' AND Type != 'dogear'").Count(&sideloadedCount)
-	Conn.Model(&Bookmark{}).Where("VolumeID NOT LIKE '%file:///%' AND Type != 'dogear'").Count(&officialCount)
+	query.Session(&gorm.Session{}).Where("VolumeID LIKE '%file:///%'").Count(&sideloadedCount)
+	query.Session(&gorm.Session{}).Where("VolumeID NOT LIKE '%file:///%'").Count(&officialCount)
 	return HighlightCounts{
 		Total:      totalCount,
 		Official:   officialCount,
@@ -275,6 +571,63 @@ func (k *Kobo) CountDeviceBookmarks(logger *slog.Logger) HighlightCounts {
 	}
 }
 
+// assignColours fills in the colour of each bookmark when the device records them
+func (k *Kobo) assignColours(bookmarks []Bookmark, logger *slog.Logger) error {
+	if !Conn.Migrator().HasColumn(&Bookmark{}, "Color") {
+		logger.Debug("Device firmware predates highlight colours")
+		return nil
+	}
+	var rows []struct {
+		BookmarkID string
+		Color      sql.NullInt64
+	}
+	result := Conn.Model(&Bookmark{}).Select("BookmarkID, Color").Scan(&rows)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve highlight colours from device",
+			slog.String("error", result.Error.Error()),
+		)
+		return result.Error
+	}
+	colours := make(map[string]HighlightColour, len(rows))
+	for _, row := range rows {
+		if row.Color.Valid && row.Color.Int64 >= 0 && row.Color.Int64 < int64(len(HighlightColours)) {
+			colours[row.BookmarkID] = HighlightColours[row.Color.Int64]
+		}
+	}
+	for i, bookmark := range bookmarks {
+		bookmarks[i].Colour = colours[bookmark.BookmarkID]
+	}
+	return nil
+}
+
+// bookmarkVisibility reports whether each bookmark on the device, of any type, has been hidden
+func (k *Kobo) bookmarkVisibility(logger *slog.Logger) (map[string]bool, error) {
+	var rows []struct {
+		BookmarkID string
+		Hidden     bool
+	}
+	result := Conn.Model(&Bookmark{}).Select("BookmarkID, " + bookmarkHiddenExpr + " AS Hidden").Scan(&rows)
+	if result.Error != nil {
+		logger.Error("Failed to check which bookmarks are hidden on device",
+			slog.String("error", result.Error.Error()),
+		)
+		return nil, result.Error
+	}
+	hidden := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		hidden[row.BookmarkID] = row.Hidden
+	}
+	return hidden, nil
+}
+
+func bookmarkTypeValues(types []BookmarkType) []string {
+	values := []string{}
+	for _, t := range types {
+		values = append(values, string(t))
+	}
+	return values
+}
+
 func getFallbackSkus() map[string]Kobo {
 	return map[string]Kobo{
 		"00000000-0000-0000-0000-000000000386": {
@@ -50,39 +50,132 @@ func TestGetKoboMetadata_HandleConnectedDevices(t *testing.T) {
 	fakeUnknownVolume := setupTmpKobo(unknownTempDir, unknownDeviceId)
 	expected := []Kobo{
 		{
-			Name:       "Kobo Libra 2",
-			Storage:    32,
-			DisplayPPI: 300,
-			MntPath:    libraTempDir,
-			DbPath:     filepath.Join(libraTempDir, "/.kobo/KoboReader.sqlite"),
+			Name:            "Kobo Libra 2",
+			Storage:         32,
+			DisplayPPI:      300,
+			MntPath:         libraTempDir,
+			DbPath:          filepath.Join(libraTempDir, "/.kobo/KoboReader.sqlite"),
+			Serial:          "NXXXXXXXXXX",
+			FirmwareVersion: "4.30.18838",
+			DeviceID:        "00000000-0000-0000-0000-000000000388",
 		},
 		{
-			Name:       "Kobo Mini",
-			Storage:    2,
-			DisplayPPI: 200,
-			MntPath:    miniTempDir,
-			DbPath:     filepath.Join(miniTempDir, "/.kobo/KoboReader.sqlite"),
+			Name:            "Kobo Mini",
+			Storage:         2,
+			DisplayPPI:      200,
+			MntPath:         miniTempDir,
+			DbPath:          filepath.Join(miniTempDir, "/.kobo/KoboReader.sqlite"),
+			Serial:          "NXXX",
+			FirmwareVersion: "4.30.18838",
+			DeviceID:        "00000000-0000-0000-0000-000000000340",
 		},
 		{
-			Name:       "Kobo Elipsa",
-			Storage:    32,
-			DisplayPPI: 227,
-			MntPath:    elipsaTempDir,
-			DbPath:     filepath.Join(elipsaTempDir, "/.kobo/KoboReader.sqlite"),
+			Name:            "Kobo Elipsa",
+			Storage:         32,
+			DisplayPPI:      227,
+			MntPath:         elipsaTempDir,
+			DbPath:          filepath.Join(elipsaTempDir, "/.kobo/KoboReader.sqlite"),
+			Serial:          "NXXX",
+			FirmwareVersion: "4.30.18838",
+			DeviceID:        "00000000-0000-0000-0000-000000000387",
 		},
 		{
-			Name:       "Kobo Clara 2E",
-			Storage:    16,
-			DisplayPPI: 300,
-			MntPath:    clara2ETempDir,
-			DbPath:     filepath.Join(clara2ETempDir, "/.kobo/KoboReader.sqlite"),
+			Name:            "Kobo Clara 2E",
+			Storage:         16,
+			DisplayPPI:      300,
+			MntPath:         clara2ETempDir,
+			DbPath:          filepath.Join(clara2ETempDir, "/.kobo/KoboReader.sqlite"),
+			Serial:          "NXXX",
+			FirmwareVersion: "4.30.18838",
+			DeviceID:        "00000000-0000-0000-0000-000000000386",
 		},
 		{
-			MntPath: unknownTempDir,
-			DbPath:  filepath.Join(unknownTempDir, "/.kobo/KoboReader.sqlite"),
+			MntPath:         unknownTempDir,
+			DbPath:          filepath.Join(unknownTempDir, "/.kobo/KoboReader.sqlite"),
+			Serial:          "NXXX",
+			FirmwareVersion: "4.30.18838",
+			DeviceID:        "00000000-0000-0000-0000-000000009999",
 		},
 	}
 	detectedPaths := []string{fakeLibraVolume, fakeMiniVolume, fakeElipsaVolume, fakeClara2EVolume, fakeUnknownVolume}
 	actual := GetKoboMetadata(detectedPaths, slog.New(&discardHandler{}))
 	assert.Equal(t, expected, actual)
 }
+
+func TestFindKobo(t *testing.T) {
+	kobos := []Kobo{
+		{Name: "Kobo Libra 2", MntPath: "/media/libra", Serial: "N418"},
+		{Name: "Kobo Clara 2E", MntPath: "/media/clara-a", Serial: "N506A"},
+		{Name: "Kobo Clara 2E", MntPath: "/media/clara-b", Serial: "N506B"},
+	}
+	testCases := []struct {
+		name     string
+		query    string
+		expected string
+		err      string
+	}{
+		{name: "serial", query: "n506b", expected: "/media/clara-b"},
+		{name: "mount path", query: "/media/clara-a/", expected: "/media/clara-a"},
+		{name: "unique name", query: "kobo libra 2", expected: "/media/libra"},
+		{name: "ambiguous name", query: "Kobo Clara 2E", err: "pick one by serial instead: N506A, N506B"},
+		{name: "no match", query: "Kobo Sage", err: `no connected kobo has the serial, mount path or name "Kobo Sage"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := FindKobo(kobos, tc.query)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual.MntPath)
+		})
+	}
+}
+
+func TestAssignChapters(t *testing.T) {
+	volume := "file:///mnt/onboard/book.kepub.epub"
+	chapters := []Content{
+		{ContentID: volume + "!!OEBPS/ch01.xhtml", BookID: volume, Title: "Chapter One", VolumeIndex: 2, FileSize: 300},
+		{ContentID: volume + "!OEBPS!intro.xhtml-1", BookID: volume, Title: " Introduction ", VolumeIndex: 0, FileSize: 100},
+		{ContentID: volume + "!OEBPS!intro.xhtml-2", BookID: volume, Title: "A Subheading", VolumeIndex: 1, FileSize: 100},
+	}
+	kb := &Kobo{}
+	chapterIndex := kb.BuildChapterIndex(chapters, slog.New(&discardHandler{}))
+	bookmarks := []Bookmark{
+		{BookmarkID: "a", VolumeID: volume, ContentID: volume + "!!OEBPS/ch01.xhtml", ChapterProgress: 0.1},
+		{BookmarkID: "b", VolumeID: volume, ContentID: volume + "!!OEBPS/intro.xhtml", ChapterProgress: 0.9},
+		{BookmarkID: "c", VolumeID: volume, ContentID: volume + "!!OEBPS/missing.xhtml", ChapterProgress: 0.5},
+	}
+	assignChapters(bookmarks, chapterIndex, chapterSpans(chapters))
+	// Bookmarks are ordered by position, with those whose chapter is unknown first
+	assert.Equal(t, []string{"c", "b", "a"}, []string{bookmarks[0].BookmarkID, bookmarks[1].BookmarkID, bookmarks[2].BookmarkID})
+
+	assert.Equal(t, -1, bookmarks[0].ChapterIndex)
+	assert.Empty(t, bookmarks[0].ChapterTitle)
+	assert.Equal(t, -1.0, bookmarks[0].BookProgress)
+
+	// Both table of contents entries for the introduction share its file so it is a quarter of the book
+	assert.Equal(t, "Introduction", bookmarks[1].ChapterTitle)
+	assert.Equal(t, 0, bookmarks[1].ChapterIndex)
+	assert.InDelta(t, 0.9, bookmarks[1].Position, 0.001)
+	assert.InDelta(t, 22.5, bookmarks[1].BookProgress, 0.001)
+
+	assert.Equal(t, "Chapter One", bookmarks[2].ChapterTitle)
+	assert.Equal(t, 2, bookmarks[2].ChapterIndex)
+	assert.InDelta(t, 2.1, bookmarks[2].Position, 0.001)
+	assert.InDelta(t, 32.5, bookmarks[2].BookProgress, 0.001)
+}
+
+func TestChapterSpans_FallsBackToEqualChapters(t *testing.T) {
+	chapters := []Content{
+		{ContentID: "book!a", BookID: "book", VolumeIndex: 0, FileSize: 100},
+		{ContentID: "book!b", BookID: "book", VolumeIndex: 1},
+		{ContentID: "other!a", BookID: "other", VolumeIndex: 0, WordCount: "300"},
+		{ContentID: "other!b", BookID: "other", VolumeIndex: 1, WordCount: "100"},
+	}
+	spans := chapterSpans(chapters)
+	// A chapter without a size means none of the sizes can be trusted
+	assert.Equal(t, chapterSpan{start: 0.5, share: 0.5}, spans["book!b"])
+	assert.Equal(t, chapterSpan{start: 0.75, share: 0.25}, spans["other!b"])
+}
@@ -0,0 +1,309 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"github.com/pgaskin/koboutils/v2/kobo"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// DoctorCheck is the outcome of checking one thing that could stop a sync from working
+type DoctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+type DoctorReport struct {
+	Checks []DoctorCheck `json:"checks"`
+}
+
+// DoctorOptions picks which device the doctor looks at, the same way that the cli does for syncs
+type DoctorOptions struct {
+	Portable bool
+	DbPath   string
+	MntPath  string
+	Device   string
+}
+
+func (r *DoctorReport) add(name string, status string, detail string, args ...any) {
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, Status: status, Detail: fmt.Sprintf(detail, args...)})
+}
+
+// Failed reports whether any check failed outright
+func (r DoctorReport) Failed() bool {
+	for _, check := range r.Checks {
+		if check.Status == CheckFail {
+			return true
+		}
+	}
+	return false
+}
+
+// RunDoctor checks everything that can go wrong before a sync without changing anything. Unlike
+// StartBackend it carries on past problems so that it can report on as much as possible.
+func RunDoctor(opts DoctorOptions, logger *slog.Logger) DoctorReport {
+	var report DoctorReport
+	var settings *Settings
+	if path, err := LocateConfigFile(configFilename, opts.Portable); err != nil {
+		report.add("settings", CheckFail, "couldn't create the settings directory: %s", err)
+	} else {
+		settings = checkSettings(&report, path)
+	}
+	if settings != nil {
+		checkTokens(&report, settings)
+	}
+	checkDirectories(&report, opts.Portable)
+
+	var targets []Kobo
+	if opts.DbPath != "" || opts.MntPath != "" {
+		dbPath := opts.DbPath
+		if dbPath == "" {
+			dbPath = filepath.Join(opts.MntPath, ".kobo", "KoboReader.sqlite")
+		}
+		targets = []Kobo{localKobo(dbPath, opts.MntPath, logger)}
+	} else {
+		targets = checkDetection(&report, opts.Device, logger)
+	}
+	for _, kb := range targets {
+		checkDevice(&report, kb, settings, logger)
+	}
+	return report
+}
+
+func checkSettings(report *DoctorReport, path string) *Settings {
+	s := defaultSettings(path)
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		report.add("settings", CheckWarn, "no settings file at %s so the defaults will be used", path)
+		return s
+	}
+	if err != nil {
+		report.add("settings", CheckFail, "couldn't read %s: %s", path, err)
+		return nil
+	}
+	parseErr := json.Unmarshal(b, s)
+	if parseErr == nil {
+		report.add("settings", CheckPass, "%s parsed", path)
+		return s
+	}
+	if err := json.Unmarshal([]byte(repairSettings(string(b))), s); err == nil {
+		report.add("settings", CheckWarn, "%s has duplicate braces from v1.6.0 or earlier. it will be repaired the next time noctober starts", path)
+		return s
+	}
+	report.add("settings", CheckFail, "%s isn't valid json: %s", path, parseErr)
+	return nil
+}
+
+func checkTokens(report *DoctorReport, settings *Settings) {
+	var unknown []string
+	for _, name := range settings.Destinations {
+		if _, ok := destinationFactories[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	switch {
+	case len(unknown) > 0:
+		report.add("destinations", CheckFail, "unknown destinations %s are enabled. available destinations are %v", strings.Join(unknown, ", "), AvailableDestinations())
+	case len(settings.Destinations) == 0:
+		report.add("destinations", CheckFail, "no destinations are enabled so there is nowhere to send highlights")
+	default:
+		report.add("destinations", CheckPass, "syncing to %s", strings.Join(settings.Destinations, ", "))
+	}
+	tokens := map[string]string{
+		NotadoDestinationName:   settings.NotadoToken,
+		ReadwiseDestinationName: settings.ReadwiseToken,
+	}
+	for _, name := range []string{NotadoDestinationName, ReadwiseDestinationName} {
+		enabled := false
+		for _, destination := range settings.Destinations {
+			enabled = enabled || destination == name
+		}
+		switch {
+		case tokens[name] != "":
+			report.add(name+" token", CheckPass, "a token is configured")
+		case enabled:
+			report.add(name+" token", CheckFail, "%s is enabled but no token is configured", name)
+		}
+	}
+}
+
+func checkDirectories(report *DoctorReport, portable bool) {
+	dirs := []struct {
+		name string
+		path string
+	}{
+		{name: "log directory", path: "october/logs"},
+		{name: "data directory", path: filepath.Dir(syncStateFilename)},
+	}
+	for _, dir := range dirs {
+		path, err := LocateDataFile(dir.path, portable)
+		if err == nil {
+			err = os.MkdirAll(path, 0755)
+		}
+		if err == nil {
+			var f *os.File
+			f, err = os.CreateTemp(path, ".noctober-doctor")
+			if err == nil {
+				f.Close()
+				os.Remove(f.Name())
+			}
+		}
+		if err != nil {
+			report.add(dir.name, CheckFail, "%s isn't writable: %s", path, err)
+			continue
+		}
+		report.add(dir.name, CheckPass, "%s is writable", path)
+	}
+}
+
+func checkDetection(report *DoctorReport, device string, logger *slog.Logger) []Kobo {
+	paths, err := kobo.Find()
+	if err != nil {
+		report.add("detection", CheckFail, "looking for kobos failed: %s", err)
+		return nil
+	}
+	kobos := GetKoboMetadata(paths, logger)
+	if len(kobos) == 0 {
+		report.add("detection", CheckWarn, "no kobo is plugged in. connect one and accept the connection request, or point at a database with --db")
+		return nil
+	}
+	report.add("detection", CheckPass, "found %d kobo(s)", len(kobos))
+	if device == "" {
+		return kobos
+	}
+	kb, err := FindKobo(kobos, device)
+	if err != nil {
+		report.add("detection", CheckFail, "%s", err)
+		return nil
+	}
+	return []Kobo{kb}
+}
+
+// checkDevice looks over a single device, prefixing each check with the device so that
+// several devices can share a report
+func checkDevice(report *DoctorReport, kb Kobo, settings *Settings, logger *slog.Logger) {
+	prefix := kb.Name
+	if prefix == "" {
+		prefix = kb.MntPath
+	}
+	if kb.MntPath != kb.DbPath {
+		serial, version, id, err := kobo.ParseKoboVersion(kb.MntPath)
+		if err != nil {
+			report.add(prefix+": version", CheckWarn, "couldn't parse .kobo/version: %s", err)
+		} else {
+			report.add(prefix+": version", CheckPass, "serial %s running firmware %s (%s)", serial, version, id)
+		}
+	}
+	if _, err := os.Stat(kb.DbPath); err != nil {
+		report.add(prefix+": database", CheckFail, "couldn't find %s: %s", kb.DbPath, err)
+		return
+	}
+	dsn, err := readOnlyDSN(kb.DbPath)
+	var db *gorm.DB
+	if err == nil {
+		db, err = gorm.Open(sqlite.Open(dsn), &gorm.Config{
+			Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+		})
+	}
+	if err == nil {
+		err = db.Exec("SELECT 1 FROM sqlite_master LIMIT 1").Error
+	}
+	if err != nil {
+		report.add(prefix+": database", CheckFail, "couldn't open %s read only: %s", kb.DbPath, err)
+		return
+	}
+	defer closeDB(db)
+	report.add(prefix+": database", CheckPass, "%s opened read only", kb.DbPath)
+
+	var versions []string
+	if err := db.Raw("SELECT version FROM DbVersion").Scan(&versions).Error; err != nil || len(versions) == 0 {
+		report.add(prefix+": schema", CheckWarn, "couldn't read the schema version. this may not be a kobo database")
+	} else {
+		report.add(prefix+": schema", CheckPass, "schema version %s", versions[0])
+	}
+
+	checkColumns(report, prefix, db, Content{}.TableName(), Content{})
+	checkColumns(report, prefix, db, Bookmark{}.TableName(), Bookmark{})
+	hasColours := db.Migrator().HasColumn(&Bookmark{}, "Color")
+	switch {
+	case hasColours:
+		report.add(prefix+": highlight colours", CheckPass, "firmware records highlight colours")
+	case settings != nil && len(settings.HighlightColourTags) > 0:
+		report.add(prefix+": highlight colours", CheckWarn, "tags are set for highlight colours but this firmware doesn't record them")
+	}
+
+	counts := kb.CountDeviceBookmarks(db, settings != nil && settings.IncludeHiddenHighlights, settings.bookmarkTypes(), logger)
+	detail := fmt.Sprintf("%d highlights: %d sideloaded, %d from the store", counts.Total, counts.Sideloaded, counts.Official)
+	switch {
+	case counts.Total == 0:
+		report.add(prefix+": highlights", CheckWarn, "%s. there is nothing to sync", detail)
+	case settings != nil && !settings.UploadStoreHighlights && counts.Sideloaded == 0:
+		report.add(prefix+": highlights", CheckWarn, "%s. store highlights are turned off so nothing will be synced", detail)
+	default:
+		report.add(prefix+": highlights", CheckPass, "%s", detail)
+	}
+}
+
+// checkColumns makes sure that the table has a column for every field that noctober reads into.
+// Kobo adds and occasionally renames columns between firmware versions.
+func checkColumns(report *DoctorReport, prefix string, db *gorm.DB, table string, model any) {
+	var columns []struct {
+		Name string
+	}
+	if err := db.Raw(fmt.Sprintf("PRAGMA table_info(%s)", table)).Scan(&columns).Error; err != nil || len(columns) == 0 {
+		report.add(prefix+": "+table+" columns", CheckFail, "the %s table is missing", table)
+		return
+	}
+	present := map[string]bool{}
+	for _, column := range columns {
+		present[strings.ToLower(column.Name)] = true
+	}
+	var missing []string
+	for _, column := range expectedColumns(model) {
+		if !present[strings.ToLower(column)] {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		report.add(prefix+": "+table+" columns", CheckWarn, "missing %s. these will be left blank", strings.Join(missing, ", "))
+		return
+	}
+	report.add(prefix+": "+table+" columns", CheckPass, "all %d expected columns are present", len(expectedColumns(model)))
+}
+
+// expectedColumns lists the columns that gorm will read a model from, which is the column
+// tag when there is one and otherwise the field name itself. Fields that gorm ignores are
+// filled in some other way so they are left out.
+func expectedColumns(model any) []string {
+	var columns []string
+	t := reflect.TypeOf(model)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("gorm") == "-" {
+			continue
+		}
+		column := field.Name
+		for _, setting := range strings.Split(field.Tag.Get("gorm"), ";") {
+			if name, ok := strings.CutPrefix(setting, "column:"); ok {
+				column = name
+			}
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
@@ -0,0 +1,99 @@
+package backend
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func statuses(report DoctorReport) map[string]string {
+	result := map[string]string{}
+	for _, check := range report.Checks {
+		result[check.Name] = check.Status
+	}
+	return result
+}
+
+func TestCheckSettings(t *testing.T) {
+	testCases := []struct {
+		name     string
+		contents string
+		status   string
+	}{
+		{name: "valid", contents: `{"notado_token": "token", "upload_store_highlights": true}`, status: CheckPass},
+		{name: "v1.6.0 braces", contents: `{{"notado_token": "token", "upload_store_highlights": true}}`, status: CheckWarn},
+		{name: "corrupt", contents: `{"notado_token": `, status: CheckFail},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			assert.NoError(t, os.WriteFile(path, []byte(tc.contents), 0644))
+			var report DoctorReport
+			settings := checkSettings(&report, path)
+			assert.Equal(t, tc.status, report.Checks[0].Status)
+			if tc.status != CheckFail {
+				assert.Equal(t, "token", settings.NotadoToken)
+			}
+			// The doctor only looks so a corrupted file must be left for LoadSettings to repair
+			contents, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.contents, string(contents))
+		})
+	}
+}
+
+func TestCheckTokens(t *testing.T) {
+	var report DoctorReport
+	checkTokens(&report, &Settings{Destinations: []string{NotadoDestinationName, ReadwiseDestinationName}, NotadoToken: "token"})
+	assert.Equal(t, map[string]string{
+		"destinations":   CheckPass,
+		"notado token":   CheckPass,
+		"readwise token": CheckFail,
+	}, statuses(report))
+	assert.True(t, report.Failed())
+}
+
+func TestCheckDevice(t *testing.T) {
+	dbPath := setupFixtureDB(t)
+	mount := setupTmpKobo(t.TempDir(), libraTwoDeviceId)
+	kb := localKobo(dbPath, mount, slog.New(&discardHandler{}))
+	var report DoctorReport
+
+	checkDevice(&report, kb, &Settings{UploadStoreHighlights: true}, slog.New(&discardHandler{}))
+	assert.Equal(t, map[string]string{
+		"Kobo Libra 2: version":          CheckPass,
+		"Kobo Libra 2: database":         CheckPass,
+		"Kobo Libra 2: schema":           CheckPass,
+		"Kobo Libra 2: Content columns":  CheckWarn,
+		"Kobo Libra 2: Bookmark columns": CheckWarn,
+		"Kobo Libra 2: highlights":       CheckPass,
+	}, statuses(report))
+	for _, check := range report.Checks {
+		switch check.Name {
+		case "Kobo Libra 2: schema":
+			assert.Equal(t, "schema version 174", check.Detail)
+		case "Kobo Libra 2: highlights":
+			assert.Equal(t, "4 highlights: 3 sideloaded, 1 from the store", check.Detail)
+		}
+	}
+	assert.False(t, report.Failed())
+
+	report = DoctorReport{}
+	checkDevice(&report, kb, &Settings{HighlightColourTags: map[HighlightColour]string{HighlightColourBlue: "vocab"}}, slog.New(&discardHandler{}))
+	assert.Equal(t, CheckWarn, statuses(report)["Kobo Libra 2: highlight colours"])
+
+	report = DoctorReport{}
+	checkDevice(&report, Kobo{Name: "Missing", DbPath: filepath.Join(t.TempDir(), "KoboReader.sqlite")}, nil, slog.New(&discardHandler{}))
+	assert.True(t, report.Failed())
+}
+
+func TestExpectedColumns(t *testing.T) {
+	columns := expectedColumns(Bookmark{})
+	assert.Contains(t, columns, "BookmarkID")
+	assert.Contains(t, columns, "VolumeID")
+	assert.NotContains(t, columns, "Colour")
+	assert.Contains(t, expectedColumns(Content{}), "___PercentRead")
+}
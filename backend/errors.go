@@ -0,0 +1,171 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NoHighlightsError is returned when a device has nothing that could be synced, which is
+// worth telling apart from a sync that failed
+type NoHighlightsError struct {
+	Message string
+}
+
+func (e *NoHighlightsError) Error() string {
+	return e.Message
+}
+
+// MissingTokenError is returned when a destination that needs an access token doesn't have one
+// configured, so nothing was sent to it
+type MissingTokenError struct {
+	Destination string
+	// Hint tells the user where they can find a token, if there is anywhere in particular
+	Hint string
+}
+
+func (e *MissingTokenError) Error() string {
+	if e.Hint == "" {
+		return fmt.Sprintf("no %s token was configured", e.Destination)
+	}
+	return fmt.Sprintf("no %s token was configured. %s", e.Destination, e.Hint)
+}
+
+// IsAuthError reports whether a destination rejected, or was never given, an access token
+func IsAuthError(err error) bool {
+	var notadoErr *NotadoAuthError
+	var readwiseErr *ReadwiseAuthError
+	return errors.As(err, &notadoErr) || errors.As(err, &readwiseErr) || IsMissingTokenError(err)
+}
+
+// IsMissingTokenError reports whether a sync was abandoned because no access token was configured,
+// as opposed to a destination rejecting the token that was sent
+func IsMissingTokenError(err error) bool {
+	var missing *MissingTokenError
+	return errors.As(err, &missing)
+}
+
+// IsNetworkError reports whether err came from a destination being unreachable or failing on
+// its end, rather than it rejecting what was sent. These are usually fixed by trying again later.
+func IsNetworkError(err error) bool {
+	var retryable *retryableError
+	var serverErr *NotadoServerError
+	var netErr net.Error
+	return errors.As(err, &retryable) || errors.As(err, &serverErr) || errors.As(err, &netErr)
+}
+
+// NotadoAuthError is returned when Notado doesn't accept the configured access token
+type NotadoAuthError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *NotadoAuthError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("notado rejected the access token (status code %d). is your access token correct?", e.StatusCode)
+	}
+	return fmt.Sprintf("notado rejected the access token: %s. is your access token correct?", e.Message)
+}
+
+// NotadoValidationError is returned when Notado refuses a note, such as when a required
+// field is missing. NoteIndex is the position of the offending note within its batch or
+// -1 if Notado didn't say which note was at fault.
+type NotadoValidationError struct {
+	NoteIndex int
+	Title     string
+	Content   string
+	Message   string
+}
+
+func (e *NotadoValidationError) Error() string {
+	if e.NoteIndex < 0 {
+		return fmt.Sprintf("notado rejected the highlights that were sent: %s", e.Message)
+	}
+	return fmt.Sprintf("notado rejected a highlight from %q (%q): %s", e.Title, TruncateText(e.Content, 40), e.Message)
+}
+
+// NotadoServerError is returned when Notado fails to process a request on its end
+type NotadoServerError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *NotadoServerError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("notado encountered an error (status code %d)", e.StatusCode)
+	}
+	return fmt.Sprintf("notado encountered an error (status code %d): %s", e.StatusCode, e.Message)
+}
+
+type graphqlError struct {
+	Message    string        `json:"message"`
+	Path       []interface{} `json:"path"`
+	Extensions struct {
+		Code string `json:"code"`
+	} `json:"extensions"`
+}
+
+var noteIndexPattern = regexp.MustCompile(`notes\[(\d+)\]`)
+
+// classifyGraphQLError maps a GraphQL error onto one of our typed errors. Notado may point
+// at a specific note either through the error path or within the message itself.
+func classifyGraphQLError(gqlErr graphqlError, highlights []Highlight) error {
+	code := strings.ToUpper(gqlErr.Extensions.Code)
+	message := strings.ToLower(gqlErr.Message)
+	switch {
+	case code == "UNAUTHENTICATED" || code == "FORBIDDEN" ||
+		strings.Contains(message, "unauthorized") || strings.Contains(message, "unauthorised") ||
+		strings.Contains(message, "invalid token"):
+		return &NotadoAuthError{StatusCode: 200, Message: gqlErr.Message}
+	case code == "BAD_USER_INPUT" || code == "GRAPHQL_VALIDATION_FAILED" || code == "GRAPHQL_PARSE_FAILED":
+		return newValidationError(gqlErr, highlights)
+	}
+	if noteIndex(gqlErr) >= 0 {
+		return newValidationError(gqlErr, highlights)
+	}
+	return &NotadoServerError{StatusCode: 200, Message: gqlErr.Message}
+}
+
+func newValidationError(gqlErr graphqlError, highlights []Highlight) *NotadoValidationError {
+	validationErr := &NotadoValidationError{
+		NoteIndex: noteIndex(gqlErr),
+		Message:   gqlErr.Message,
+	}
+	if validationErr.NoteIndex >= len(highlights) {
+		validationErr.NoteIndex = -1
+	}
+	if validationErr.NoteIndex >= 0 {
+		validationErr.Title = highlights[validationErr.NoteIndex].Title
+		validationErr.Content = highlights[validationErr.NoteIndex].Content
+	}
+	return validationErr
+}
+
+func noteIndex(gqlErr graphqlError) int {
+	for i, segment := range gqlErr.Path {
+		if segment != "notes" || i+1 >= len(gqlErr.Path) {
+			continue
+		}
+		if idx, ok := gqlErr.Path[i+1].(float64); ok {
+			return int(idx)
+		}
+	}
+	if match := noteIndexPattern.FindStringSubmatch(gqlErr.Message); match != nil {
+		if idx, err := strconv.Atoi(match[1]); err == nil {
+			return idx
+		}
+	}
+	return -1
+}
+
+// TruncateText shortens s to at most n runes, marking the cut with an ellipsis
+func TruncateText(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
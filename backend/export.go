@@ -0,0 +1,244 @@
+package backend
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatJSON   = "json"
+	ExportFormatNDJSON = "ndjson"
+
+	// ExportTypePageMarker is the type given to dogears in exports since they mark a page
+	// rather than any particular text
+	ExportTypePageMarker = "page_marker"
+
+	OriginStore      = "store"
+	OriginSideloaded = "sideloaded"
+)
+
+// ExportRecord is a single bookmark joined with the book that it belongs to, flattened
+// so that it can be written out as a row in a spreadsheet
+type ExportRecord struct {
+	BookmarkID      string  `json:"bookmark_id"`
+	BookTitle       string  `json:"book_title"`
+	Author          string  `json:"author"`
+	ISBN            string  `json:"isbn"`
+	Chapter         string  `json:"chapter"`
+	ChapterIndex    int     `json:"chapter_index"`
+	Text            string  `json:"text"`
+	Context         string  `json:"context"`
+	Annotation      string  `json:"annotation"`
+	Type            string  `json:"type"`
+	Colour          string  `json:"colour"`
+	ChapterProgress float64 `json:"chapter_progress"`
+	BookProgress    float64 `json:"book_progress"`
+	DateCreated     string  `json:"date_created"`
+	DateModified    string  `json:"date_modified"`
+	Origin          string  `json:"origin"`
+	Markup          string  `json:"markup"`
+}
+
+var exportColumns = []string{
+	"bookmark_id",
+	"book_title",
+	"author",
+	"isbn",
+	"chapter",
+	"chapter_index",
+	"text",
+	"context",
+	"annotation",
+	"type",
+	"colour",
+	"chapter_progress",
+	"book_progress",
+	"date_created",
+	"date_modified",
+	"origin",
+	"markup",
+}
+
+func (r ExportRecord) row() []string {
+	return []string{
+		r.BookmarkID,
+		r.BookTitle,
+		r.Author,
+		r.ISBN,
+		r.Chapter,
+		strconv.Itoa(r.ChapterIndex),
+		r.Text,
+		r.Context,
+		r.Annotation,
+		r.Type,
+		r.Colour,
+		strconv.FormatFloat(r.ChapterProgress, 'f', -1, 64),
+		strconv.FormatFloat(r.BookProgress, 'f', 2, 64),
+		r.DateCreated,
+		r.DateModified,
+		r.Origin,
+		r.Markup,
+	}
+}
+
+// ExportHighlights returns every bookmark on the selected device, including those in store
+// bought books, regardless of whether it has been synced anywhere before
+func (b *Backend) ExportHighlights() ([]ExportRecord, error) {
+	content, err := b.Kobo.ListDeviceContent(true, b.logger)
+	if err != nil {
+		slog.Error("Received an error trying to list content from device",
+			slog.String("error", err.Error()),
+		)
+		return nil, err
+	}
+	contentIndex := b.Kobo.BuildContentIndex(content, b.logger)
+	types := b.Settings.bookmarkTypes()
+	if b.Settings.ExportPageMarkers {
+		types = append(slices.Clone(types), BookmarkTypeDogear)
+	}
+	bookmarks, err := b.Kobo.ListDeviceBookmarks(true, b.Settings.IncludeHiddenHighlights, types, b.logger)
+	if err != nil {
+		slog.Error("Received an error trying to list bookmarks from device",
+			slog.String("error", err.Error()),
+		)
+		return nil, err
+	}
+	if err := b.resolveChapters(bookmarks); err != nil {
+		return nil, err
+	}
+	b.extractMarkups(bookmarks)
+	b.resolveContext(bookmarks)
+	records := BuildExportRecords(bookmarks, contentIndex)
+	slog.Info("Built highlight export",
+		slog.Int("record_count", len(records)),
+	)
+	return records, nil
+}
+
+// BuildExportRecords joins each bookmark with its book. Bookmarks whose book can't be found
+// are still exported, just without any book details.
+func BuildExportRecords(bookmarks []Bookmark, contentIndex map[string]Content) []ExportRecord {
+	records := []ExportRecord{}
+	for _, bookmark := range bookmarks {
+		book := contentIndex[bookmark.VolumeID]
+		recordType := string(bookmark.kind())
+		if bookmark.kind() == BookmarkTypeDogear {
+			recordType = ExportTypePageMarker
+		}
+		// Not every book has a table of contents so the file is better than nothing
+		chapter := bookmark.ChapterTitle
+		if chapter == "" {
+			chapter = chapterPath(bookmark)
+		}
+		origin := OriginStore
+		if strings.Contains(bookmark.VolumeID, "file:///") {
+			origin = OriginSideloaded
+		}
+		records = append(records, ExportRecord{
+			BookmarkID:      bookmark.BookmarkID,
+			BookTitle:       book.Title,
+			Author:          book.Attribution,
+			ISBN:            book.ISBN,
+			Chapter:         chapter,
+			ChapterIndex:    bookmark.ChapterIndex,
+			Text:            NormaliseText(bookmark.Text),
+			Context:         bookmark.Context,
+			Annotation:      bookmark.Annotation,
+			Type:            recordType,
+			Colour:          string(bookmark.Colour),
+			ChapterProgress: bookmark.ChapterProgress,
+			BookProgress:    bookmark.BookProgress,
+			DateCreated:     normaliseTimestamp(bookmark.DateCreated),
+			DateModified:    normaliseTimestamp(bookmark.DateModified),
+			Origin:          origin,
+			Markup:          bookmark.MarkupPath,
+		})
+	}
+	return records
+}
+
+// ValidateExportFormat checks that format is one WriteExport knows how to write, so that
+// callers can find out before creating anything to write to
+func ValidateExportFormat(format string) error {
+	switch format {
+	case ExportFormatCSV, ExportFormatJSON, ExportFormatNDJSON:
+		return nil
+	}
+	return fmt.Errorf("unknown export format %q. expected %s, %s or %s", format, ExportFormatCSV, ExportFormatJSON, ExportFormatNDJSON)
+}
+
+// WriteExport writes records to w as csv, a json array or newline delimited json
+func WriteExport(w io.Writer, records []ExportRecord, format string) error {
+	switch format {
+	case ExportFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(exportColumns); err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := cw.Write(record.row()); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case ExportFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case ExportFormatNDJSON:
+		enc := json.NewEncoder(w)
+		for _, record := range records {
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return ValidateExportFormat(format)
+	}
+}
+
+// chapterPath returns the file within the book that a bookmark was made in. Kobo separates
+// this from the book path differently depending on whether the book is a kepub, an epub or
+// was bought from the store.
+func chapterPath(bookmark Bookmark) string {
+	contentID := strings.TrimPrefix(bookmark.ContentID, bookmark.VolumeID)
+	for _, separator := range []string{"!!", "!"} {
+		if strings.HasPrefix(contentID, separator) {
+			return strings.TrimPrefix(contentID, separator)
+		}
+	}
+	if strings.HasPrefix(contentID, "#(") {
+		if _, path, ok := strings.Cut(contentID, ")"); ok {
+			return path
+		}
+	}
+	return contentID
+}
+
+// normaliseTimestamp converts the handful of timestamp layouts Kobo uses into RFC 3339,
+// leaving anything it doesn't recognise untouched
+func normaliseTimestamp(timestamp string) string {
+	if t, ok := parseKoboTimestamp(timestamp); ok {
+		return t.Format(time.RFC3339)
+	}
+	return timestamp
+}
+
+func parseKoboTimestamp(timestamp string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02T15:04:05.000", "2006-01-02T15:04:05Z", time.RFC3339} {
+		if t, err := time.Parse(layout, timestamp); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
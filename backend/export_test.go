@@ -0,0 +1,123 @@
+package backend
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportHighlights(t *testing.T) {
+	b := setupTestBackend(t, "")
+	b.Settings.NotadoToken = ""
+	b.Settings.UploadStoreHighlights = false
+
+	records, err := b.ExportHighlights()
+	assert.NoError(t, err)
+	// The dogear is left out unless page markers are turned on
+	assert.Len(t, records, 4)
+	byID := map[string]ExportRecord{}
+	for _, record := range records {
+		byID[record.BookmarkID] = record
+	}
+	assert.Equal(t, ExportRecord{
+		BookmarkID:      "b1000000-0000-0000-0000-000000000002",
+		BookTitle:       "Dune",
+		Author:          "Frank Herbert",
+		ISBN:            "9780441013593",
+		Chapter:         "Book Two: Muad'Dib",
+		ChapterIndex:    1,
+		Text:            "The mystery of life isn't a problem to solve",
+		Annotation:      "A favourite .quote .philosophy",
+		Type:            "note",
+		ChapterProgress: 0.1,
+		BookProgress:    40,
+		DateCreated:     "2023-03-02T21:00:00Z",
+		DateModified:    "2023-03-02T21:00:00Z",
+		Origin:          OriginSideloaded,
+	}, byID["b1000000-0000-0000-0000-000000000002"])
+	assert.Equal(t, "Chapter I", byID["b1000000-0000-0000-0000-000000000004"].Chapter)
+	assert.Equal(t, "Book Two", byID["b1000000-0000-0000-0000-000000000005"].Chapter)
+	assert.Equal(t, OriginStore, byID["b1000000-0000-0000-0000-000000000005"].Origin)
+	assert.Equal(t, "Meditations", byID["b1000000-0000-0000-0000-000000000005"].BookTitle)
+}
+
+func TestExportHighlights_PageMarkers(t *testing.T) {
+	b := setupTestBackend(t, "")
+	b.Settings.ExportPageMarkers = true
+	b.Settings.BookmarkTypes = []BookmarkType{BookmarkTypeNote}
+
+	records, err := b.ExportHighlights()
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "note", records[0].Type)
+	assert.Equal(t, ExportRecord{
+		BookmarkID:      "b1000000-0000-0000-0000-000000000003",
+		BookTitle:       "Dune",
+		Author:          "Frank Herbert",
+		ISBN:            "9780441013593",
+		Chapter:         "Book Two: Muad'Dib",
+		ChapterIndex:    1,
+		Type:            ExportTypePageMarker,
+		ChapterProgress: 0.8,
+		BookProgress:    86.67,
+		DateCreated:     "2023-03-02T21:10:00Z",
+		DateModified:    "2023-03-02T21:10:00Z",
+		Origin:          OriginSideloaded,
+	}, records[1])
+}
+
+func TestExportHighlights_MarkupsByDefault(t *testing.T) {
+	b := setupTestBackend(t, "")
+	assert.NoError(t, Conn.Exec(`INSERT INTO Bookmark (BookmarkID, VolumeID, ContentID, StartContainerPath, StartContainerChildIndex, StartOffset, EndContainerPath, EndContainerChildIndex, EndOffset, Text, Annotation, DateCreated, ChapterProgress, Hidden, DateModified, Type) VALUES
+	('m1000000-0000-0000-0000-000000000001', 'file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub', 'file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub!!OEBPS/ch01.xhtml', '', 0, 0, '', 0, 0, '', '', '2023-03-03T21:00:00.000', 0.2, 'false', '2023-03-03T21:00:00Z', 'markup')`).Error)
+
+	records, err := b.ExportHighlights()
+	assert.NoError(t, err)
+	var types []string
+	for _, record := range records {
+		if record.BookmarkID == "m1000000-0000-0000-0000-000000000001" {
+			types = append(types, record.Type)
+		}
+	}
+	assert.Equal(t, []string{string(BookmarkTypeMarkup)}, types)
+}
+
+func TestBookmarkKind(t *testing.T) {
+	// Older firmware doesn't fill in the type so it is worked out from the bookmark's contents
+	assert.Equal(t, BookmarkTypeMarkup, Bookmark{Type: BookmarkTypeMarkup}.kind())
+	assert.Equal(t, BookmarkTypeNote, Bookmark{Text: "text", Annotation: "note"}.kind())
+	assert.Equal(t, BookmarkTypeHighlight, Bookmark{Text: "text"}.kind())
+	assert.Equal(t, BookmarkTypeDogear, Bookmark{}.kind())
+}
+
+func TestWriteExport(t *testing.T) {
+	records := []ExportRecord{
+		{BookmarkID: "a", BookTitle: "Emma", Text: "Emma Woodhouse, handsome", Colour: "yellow", ChapterProgress: 0.25, BookProgress: 12.5, Origin: OriginSideloaded},
+		{BookmarkID: "b", BookTitle: "Dune", Text: "Fear is\nthe mind-killer", Type: "note"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteExport(&buf, records, ExportFormatCSV))
+	assert.Equal(t, strings.Join([]string{
+		"bookmark_id,book_title,author,isbn,chapter,chapter_index,text,context,annotation,type,colour,chapter_progress,book_progress,date_created,date_modified,origin,markup",
+		"a,Emma,,,,0,\"Emma Woodhouse, handsome\",,,,yellow,0.25,12.50,,,sideloaded,",
+		"b,Dune,,,,0,\"Fear is\nthe mind-killer\",,,note,,0,0.00,,,,",
+		"",
+	}, "\n"), buf.String())
+
+	buf.Reset()
+	assert.NoError(t, WriteExport(&buf, records, ExportFormatNDJSON))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], `{"bookmark_id":"a","book_title":"Emma"`))
+
+	buf.Reset()
+	assert.NoError(t, WriteExport(&buf, records, ExportFormatJSON))
+	assert.True(t, strings.HasPrefix(buf.String(), "[\n  {\n"))
+
+	assert.ErrorContains(t, WriteExport(&buf, records, "xml"), `unknown export format "xml"`)
+	assert.ErrorContains(t, ValidateExportFormat("xml"), `unknown export format "xml"`)
+	assert.NoError(t, ValidateExportFormat(ExportFormatNDJSON))
+}
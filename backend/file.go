@@ -3,6 +3,7 @@ package backend
 import (
 	"os"
 	"path"
+	"path/filepath"
 
 	"github.com/adrg/xdg"
 )
@@ -28,3 +29,16 @@ func LocateDataFile(configFilename string, portable bool) (string, error) {
 	}
 	return xdg.DataFile(configFilename)
 }
+
+// DataFilePath is where LocateDataFile would put a file, without creating any of the
+// directories leading up to it
+func DataFilePath(configFilename string, portable bool) (string, error) {
+	if portable {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		return path.Join(cwd, configFilename), nil
+	}
+	return filepath.Join(xdg.DataHome, configFilename), nil
+}
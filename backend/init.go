@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 
 	"github.com/pgaskin/koboutils/v2/kobo"
@@ -18,7 +20,9 @@ type Backend struct {
 	ConnectedKobos map[string]Kobo
 	RuntimeContext *context.Context
 	Settings       *Settings
+	SyncState      *SyncState
 	Notado         *Notado
+	Readwise       *Readwise
 	Kobo           *Kobo
 	Content        *Content
 	Bookmark       *Bookmark
@@ -39,14 +43,28 @@ func StartBackend(ctx *context.Context, version string, portable bool, logger *s
 		)
 		return &Backend{}, err
 	}
+	syncState, err := LoadSyncState(portable, logger)
+	if err != nil {
+		logger.Error("Failed to load sync state",
+			slog.String("error", err.Error()),
+		)
+		return &Backend{}, err
+	}
 	return &Backend{
 		SelectedKobo:   Kobo{},
 		ConnectedKobos: map[string]Kobo{},
 		RuntimeContext: ctx,
 		Settings:       settings,
+		SyncState:      syncState,
 		Notado: &Notado{
 			logger:    logger,
 			UserAgent: fmt.Sprintf(UserAgentFmt, version),
+			endpoint:  resolveNotadoEndpoint(settings, logger),
+		},
+		Readwise: &Readwise{
+			logger:    logger,
+			UserAgent: fmt.Sprintf(UserAgentFmt, version),
+			endpoint:  os.Getenv(ReadwiseEndpointEnv),
 		},
 		Kobo:     &Kobo{},
 		Content:  &Content{},
@@ -57,6 +75,24 @@ func StartBackend(ctx *context.Context, version string, portable bool, logger *s
 	}, nil
 }
 
+// resolveNotadoEndpoint prefers an endpoint set in the environment over one saved in settings,
+// falling back to the production endpoint when neither is present
+func resolveNotadoEndpoint(settings *Settings, logger *slog.Logger) string {
+	if endpoint := os.Getenv(NotadoEndpointEnv); endpoint != "" {
+		logger.Info("Using Notado endpoint from environment",
+			slog.String("endpoint", endpoint),
+		)
+		return endpoint
+	}
+	if settings.NotadoEndpoint != "" {
+		logger.Info("Using Notado endpoint from settings",
+			slog.String("endpoint", settings.NotadoEndpoint),
+		)
+		return settings.NotadoEndpoint
+	}
+	return NOTADO_GRAPHQL_URL
+}
+
 func (b *Backend) GetSettings() *Settings {
 	return b.Settings
 }
@@ -111,13 +147,18 @@ func (b *Backend) NavigateExplorerToLogLocation() {
 	_ = exec.Command(explorerCommand, logLocation).Run()
 }
 
-func (b *Backend) DetectKobos() []Kobo {
+func (b *Backend) DetectKobos() ([]Kobo, error) {
 	connectedKobos, err := kobo.Find()
 	if err != nil {
-		b.logger.Error("Failed to detect any connected Kobos")
-		panic(err)
+		b.logger.Error("Failed to detect any connected Kobos",
+			slog.String("error", err.Error()),
+		)
+		return nil, fmt.Errorf("failed to look for connected kobos: %w", err)
 	}
 	kobos := GetKoboMetadata(connectedKobos, b.logger)
+	// Devices that are no longer plugged in are forgotten so that another kobo mounted at the
+	// same path is never mistaken for them
+	clear(b.ConnectedKobos)
 	b.logger.Info("Found one or more kobos",
 		"count", len(kobos),
 	)
@@ -128,10 +169,12 @@ func (b *Backend) DetectKobos() []Kobo {
 			slog.String("name", kb.Name),
 			slog.Int("display_ppi", kb.DisplayPPI),
 			slog.Int("storage", kb.Storage),
+			slog.String("serial", kb.Serial),
+			slog.String("firmware_version", kb.FirmwareVersion),
 		)
 		b.ConnectedKobos[kb.MntPath] = kb
 	}
-	return kobos
+	return kobos, nil
 }
 
 func (b *Backend) GetSelectedKobo() Kobo {
@@ -163,6 +206,51 @@ func (b *Backend) SelectKobo(devicePath string) error {
 	return nil
 }
 
+// localKobo describes a database that isn't on a connected device, picking up the device's
+// details from mntPath when it holds a copy of the device's files
+func localKobo(dbPath string, mntPath string, logger *slog.Logger) Kobo {
+	local := Kobo{
+		Name:    "Local Database",
+		MntPath: dbPath,
+		DbPath:  dbPath,
+	}
+	if mntPath != "" {
+		local.MntPath = mntPath
+		if _, err := os.Stat(filepath.Join(mntPath, ".kobo", "version")); err == nil {
+			local = GetKoboMetadata([]string{mntPath}, logger)[0]
+			local.DbPath = dbPath
+		}
+	}
+	return local
+}
+
+// SelectLocalKobo reads from a copy of a Kobo database, such as a backup, rather than a connected device.
+// mntPath optionally points at a copy of the device's files which is used to identify the device.
+func (b *Backend) SelectLocalKobo(dbPath string, mntPath string) error {
+	if _, err := os.Stat(dbPath); err != nil {
+		b.logger.Error("Failed to find local database",
+			slog.String("error", err.Error()),
+			slog.String("db_path", dbPath),
+		)
+		return fmt.Errorf("failed to find a kobo database at %s: %w", dbPath, err)
+	}
+	local := localKobo(dbPath, mntPath, b.logger)
+	b.logger.Info("Selecting local database",
+		slog.String("db_path", local.DbPath),
+		slog.String("mount_path", local.MntPath),
+		slog.String("serial", local.Serial),
+	)
+	b.SelectedKobo = local
+	if err := OpenConnection(b.SelectedKobo.DbPath); err != nil {
+		b.logger.Error("Failed to open DB connection",
+			slog.String("error", err.Error()),
+			slog.String("db_path", b.SelectedKobo.DbPath),
+		)
+		return err
+	}
+	return nil
+}
+
 func (b *Backend) PromptForLocalDBPath() error {
 	selectedFile, err := wailsRuntime.OpenFileDialog(*b.RuntimeContext, wailsRuntime.OpenDialogOptions{
 		Title: "Select local Kobo database",
@@ -183,54 +271,17 @@ func (b *Backend) PromptForLocalDBPath() error {
 	return b.SelectKobo(selectedFile)
 }
 
-func (b *Backend) ForwardToNotado() (int, error) {
-	highlightBreakdown := b.Kobo.CountDeviceBookmarks(b.logger)
-	slog.Info("Got highlight counts from device",
-		slog.Int("highlight_count_sideload", int(highlightBreakdown.Sideloaded)),
-		slog.Int("highlight_count_official", int(highlightBreakdown.Official)),
-		slog.Int("highlight_count_total", int(highlightBreakdown.Total)),
-	)
-	if highlightBreakdown.Total == 0 {
-		slog.Error("Tried to submit highlights when there are none on device.")
-		return 0, fmt.Errorf("Your device doesn't seem to have any highlights so there is nothing left to sync.")
-	}
-	includeStoreBought := b.Settings.UploadStoreHighlights
-	if !includeStoreBought && highlightBreakdown.Sideloaded == 0 {
-		slog.Error("Tried to submit highlights with no sideloaded highlights + store-bought syncing disabled. Result is that no highlights would be fetched.")
-		return 0, fmt.Errorf("You have disabled store-bought syncing but you don't have any sideloaded highlights either. This combination means there are no highlights left to be synced.")
-	}
-	content, err := b.Kobo.ListDeviceContent(includeStoreBought, b.logger)
-	if err != nil {
-		slog.Error("Received an error trying to list content from device",
-			slog.String("error", err.Error()),
-		)
-		return 0, err
-	}
-	contentIndex := b.Kobo.BuildContentIndex(content, b.logger)
-	bookmarks, err := b.Kobo.ListDeviceBookmarks(includeStoreBought, b.logger)
-	if err != nil {
-		slog.Error("Received an error trying to list bookmarks from device",
-			slog.String("error", err.Error()),
-		)
-		return 0, err
-	}
-	payload, err := BuildPayload(bookmarks, contentIndex, b.logger)
+func (b *Backend) PromptForMarkdownVaultPath() error {
+	selectedDir, err := wailsRuntime.OpenDirectoryDialog(*b.RuntimeContext, wailsRuntime.OpenDialogOptions{
+		Title:                "Select a folder to export Markdown highlights into",
+		CanCreateDirectories: true,
+	})
 	if err != nil {
-		slog.Error("Received an error trying to build Notado payload",
-			slog.String("error", err.Error()),
-		)
-		return 0, err
+		return err
 	}
-	numUploads, err := b.Notado.SendBookmarks(payload, b.Settings.NotadoToken)
-	if err != nil {
-		slog.Error("Received an error trying to send bookmarks to Notado",
-			slog.String("error", err.Error()),
-		)
-		return 0, err
+	// The user has cancelled the dialog so we just do nothing
+	if selectedDir == "" {
+		return errors.New("canceled selection")
 	}
-	slog.Info("Successfully uploaded bookmarks to Notado",
-		slog.Int("payload_count", numUploads),
-	)
-
-	return numUploads, nil
+	return b.Settings.SaveMarkdownVaultPath(selectedDir)
 }
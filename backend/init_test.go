@@ -0,0 +1,338 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/marcus-crane/october/backend/notadotest"
+	"github.com/marcus-crane/october/backend/readwisetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupFixtureDB loads testdata/KoboReader.sql into a fresh database and connects to it
+func setupFixtureDB(t *testing.T) string {
+	t.Helper()
+	schema, err := os.ReadFile(filepath.Join("testdata", "KoboReader.sql"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %+v", err)
+	}
+	dbPath := filepath.Join(t.TempDir(), "KoboReader.sqlite")
+	if err := OpenConnection(dbPath); err != nil {
+		t.Fatalf("failed to open fixture database: %+v", err)
+	}
+	if err := Conn.Exec(string(schema)).Error; err != nil {
+		t.Fatalf("failed to load fixture: %+v", err)
+	}
+	return dbPath
+}
+
+func setupTestBackend(t *testing.T, endpoint string) *Backend {
+	t.Helper()
+	logger := slog.New(&discardHandler{})
+	dbPath := setupFixtureDB(t)
+	syncState, err := loadSyncState(filepath.Join(t.TempDir(), "sync_state.json"), logger)
+	if err != nil {
+		t.Fatalf("failed to load sync state: %+v", err)
+	}
+	return &Backend{
+		SelectedKobo: Kobo{
+			Name:    "Local Database",
+			MntPath: dbPath,
+			DbPath:  dbPath,
+		},
+		ConnectedKobos: map[string]Kobo{},
+		Settings: &Settings{
+			path:                  filepath.Join(t.TempDir(), "config.json"),
+			NotadoToken:           "token",
+			UploadStoreHighlights: true,
+			Destinations:          []string{NotadoDestinationName},
+		},
+		SyncState: syncState,
+		Notado: &Notado{
+			logger:    logger,
+			UserAgent: "noctober/test",
+			endpoint:  endpoint,
+			sleep:     func(time.Duration) {},
+		},
+		Readwise: &Readwise{
+			logger:    logger,
+			UserAgent: "noctober/test",
+			sleep:     func(time.Duration) {},
+		},
+		Kobo:     &Kobo{},
+		Content:  &Content{},
+		Bookmark: &Bookmark{},
+		logger:   logger,
+		version:  "test",
+	}
+}
+
+func TestForwardToNotado_EndToEnd(t *testing.T) {
+	server := notadotest.NewServer()
+	defer server.Close()
+	server.RequireToken("token")
+	b := setupTestBackend(t, server.Endpoint())
+
+	count, err := b.ForwardToNotado()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+	notes := server.Notes()
+	assert.Len(t, notes, 4)
+	assert.Equal(t, notadotest.Note{
+		Content: "The mystery of life isn't a problem to solve",
+		URL:     "calibre://search/_?q=title:Dune author:Frank Herbert",
+		Title:   "Dune - Frank Herbert",
+		Created: "2023-03-02T21:00:00+00:00",
+		Tags:    []string{"quote", "philosophy"},
+		Author:  "Frank Herbert",
+	}, notes[3])
+
+	// Nothing has changed on the device so a second sync shouldn't send anything
+	count, err = b.ForwardToNotado()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	assert.Len(t, server.Notes(), 4)
+}
+
+func TestSyncHighlights_ReportsBooks(t *testing.T) {
+	server := notadotest.NewServer()
+	defer server.Close()
+	server.FailNext(notadotest.Failure{StatusCode: http.StatusUnauthorized})
+	b := setupTestBackend(t, server.Endpoint())
+
+	results, err := b.SyncHighlights()
+	assert.True(t, IsAuthError(err))
+	assert.False(t, IsMissingTokenError(err))
+	assert.False(t, IsNetworkError(err))
+	assert.Equal(t, []BookResult{
+		{Title: "Meditations", Author: "Marcus Aurelius", Highlights: 1},
+		{Title: "Emma", Author: "Jane Austen", Highlights: 1},
+		{Title: "Dune", Author: "Frank Herbert", Highlights: 2},
+	}, results[0].Books)
+
+	results, err = b.SyncHighlights()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, results[0].Books[2].Synced)
+}
+
+func TestSyncHighlights_ReportsOrphans(t *testing.T) {
+	server := notadotest.NewServer()
+	defer server.Close()
+	b := setupTestBackend(t, server.Endpoint())
+
+	_, err := b.SyncHighlights()
+	assert.NoError(t, err)
+	// Deleting a highlight on a Kobo hides it while some are removed from the database entirely
+	assert.NoError(t, Conn.Exec("UPDATE Bookmark SET Hidden = 'true' WHERE BookmarkID = 'b1000000-0000-0000-0000-000000000004'").Error)
+	assert.NoError(t, Conn.Exec("DELETE FROM Bookmark WHERE BookmarkID = 'b1000000-0000-0000-0000-000000000005'").Error)
+
+	results, err := b.SyncHighlights()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, results[0].Sent)
+	assert.Len(t, results[0].Orphaned, 2)
+	reasons := map[string]string{}
+	for _, orphan := range results[0].Orphaned {
+		reasons[orphan.BookmarkID] = orphan.Reason
+	}
+	assert.Equal(t, map[string]string{
+		"b1000000-0000-0000-0000-000000000004": OrphanHidden,
+		"b1000000-0000-0000-0000-000000000005": OrphanDeleted,
+	}, reasons)
+	records, err := b.ExportHighlights()
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	forgotten, err := b.ForgetOrphanedHighlights()
+	assert.NoError(t, err)
+	assert.Len(t, forgotten, 2)
+	orphans, err := b.ListOrphanedHighlights()
+	assert.NoError(t, err)
+	assert.Empty(t, orphans)
+
+	// Including hidden highlights sends the hidden one again since it was forgotten
+	b.Settings.IncludeHiddenHighlights = true
+	results, err = b.SyncHighlights()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, results[0].Sent)
+}
+
+func TestSyncHighlights_HighlightColours(t *testing.T) {
+	server := notadotest.NewServer()
+	defer server.Close()
+	b := setupTestBackend(t, server.Endpoint())
+	b.Settings.HighlightColourTags = map[HighlightColour]string{HighlightColourBlue: "vocab", HighlightColourYellow: "quote"}
+
+	// The fixture is from firmware without highlight colours so newer firmware adds the column
+	records, err := b.ExportHighlights()
+	assert.NoError(t, err)
+	assert.Empty(t, records[0].Colour)
+	assert.NoError(t, Conn.Exec("ALTER TABLE Bookmark ADD COLUMN Color INTEGER").Error)
+	assert.NoError(t, Conn.Exec("UPDATE Bookmark SET Color = 2 WHERE BookmarkID = 'b1000000-0000-0000-0000-000000000001'").Error)
+	assert.NoError(t, Conn.Exec("UPDATE Bookmark SET Color = 0 WHERE BookmarkID = 'b1000000-0000-0000-0000-000000000002'").Error)
+
+	_, err = b.SyncHighlights()
+	assert.NoError(t, err)
+	tags := map[string][]string{}
+	for _, note := range server.Notes() {
+		tags[note.Content] = note.Tags
+	}
+	assert.Equal(t, []string{"vocab"}, tags["I must not fear. Fear is the mind-killer."])
+	// A tag from the annotation isn't repeated
+	assert.Equal(t, []string{"quote", "philosophy"}, tags["The mystery of life isn't a problem to solve"])
+	assert.Empty(t, tags["Emma Woodhouse, handsome, clever, and rich"])
+
+	records, err = b.ExportHighlights()
+	assert.NoError(t, err)
+	colours := map[string]string{}
+	for _, record := range records {
+		colours[record.BookmarkID] = record.Colour
+	}
+	assert.Equal(t, "blue", colours["b1000000-0000-0000-0000-000000000001"])
+	assert.Equal(t, "", colours["b1000000-0000-0000-0000-000000000004"])
+}
+
+func TestForwardToNotado_RejectedToken(t *testing.T) {
+	server := notadotest.NewServer()
+	defer server.Close()
+	server.RequireToken("a different token")
+	b := setupTestBackend(t, server.Endpoint())
+
+	_, err := b.ForwardToNotado()
+	var authErr *NotadoAuthError
+	assert.ErrorAs(t, err, &authErr)
+	assert.Empty(t, server.Notes())
+	assert.Empty(t, b.SyncState.Destinations[NotadoDestinationName])
+}
+
+func TestForwardToNotado_RetriesServerErrors(t *testing.T) {
+	server := notadotest.NewServer()
+	defer server.Close()
+	server.FailNext(
+		notadotest.Failure{StatusCode: http.StatusServiceUnavailable},
+		notadotest.Failure{StatusCode: http.StatusTooManyRequests, RetryAfter: "1"},
+	)
+	b := setupTestBackend(t, server.Endpoint())
+
+	count, err := b.ForwardToNotado()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, 3, server.Requests())
+}
+
+// recordingDestination keeps hold of whatever it is sent so that tests can check the fan out
+type recordingDestination struct {
+	highlights []Highlight
+	err        error
+}
+
+var testRecorder = &recordingDestination{}
+
+func init() {
+	RegisterDestination("recorder", func(b *Backend) Destination {
+		return testRecorder
+	})
+}
+
+func (d *recordingDestination) Name() string {
+	return "recorder"
+}
+
+func (d *recordingDestination) Validate() error {
+	return nil
+}
+
+func (d *recordingDestination) Send(ctx context.Context, highlights []Highlight) SyncResult {
+	if d.err != nil {
+		return failedSyncResult(d.Name(), d.err)
+	}
+	d.highlights = append(d.highlights, highlights...)
+	return SyncResult{Destination: d.Name(), Sent: len(highlights), FirstFailedBatch: -1}
+}
+
+func TestSyncHighlights_FansOutToEnabledDestinations(t *testing.T) {
+	server := notadotest.NewServer()
+	defer server.Close()
+	b := setupTestBackend(t, server.Endpoint())
+	assert.NoError(t, b.Settings.SaveDestinations([]string{NotadoDestinationName, "recorder"}))
+	*testRecorder = recordingDestination{err: errors.New("disc full")}
+
+	results, err := b.SyncHighlights()
+	assert.ErrorContains(t, err, "recorder: disc full")
+	assert.Equal(t, 4, results[0].Sent)
+	assert.Equal(t, "disc full", results[1].Error)
+	assert.Len(t, server.Notes(), 4)
+
+	// Only the destination that failed should receive highlights on the next sync
+	testRecorder.err = nil
+	results, err = b.SyncHighlights()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, results[0].Sent)
+	assert.Equal(t, 4, results[1].Sent)
+	assert.Len(t, testRecorder.highlights, 4)
+	assert.Equal(t, 1, server.Requests())
+}
+
+func TestSyncHighlightsTo_Readwise(t *testing.T) {
+	server := readwisetest.NewServer()
+	defer server.Close()
+	server.RequireToken("readwise token")
+	b := setupTestBackend(t, "")
+	b.Readwise.SetEndpoint(server.Endpoint())
+	b.Settings.ReadwiseToken = "readwise token"
+
+	results, err := b.SyncHighlightsTo([]string{ReadwiseDestinationName})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, results[0].Sent)
+	highlights := server.Highlights()
+	assert.Len(t, highlights, 4)
+	var dune []readwisetest.Highlight
+	for _, highlight := range highlights {
+		if highlight.Title == "Dune" {
+			dune = append(dune, highlight)
+		}
+	}
+	assert.Len(t, dune, 2)
+	// Locations come from where each highlight is in the book so they don't change between syncs
+	assert.Equal(t, []int{5001, 11001}, []int{dune[0].Location, dune[1].Location})
+	// The note is in the second chapter so it comes after the highlight in the first
+	assert.Equal(t, "A favourite .quote .philosophy", dune[1].Note)
+	assert.Empty(t, b.SyncState.Destinations[NotadoDestinationName])
+
+	_, err = b.SyncHighlightsTo([]string{"nowhere"})
+	assert.ErrorContains(t, err, `unknown destination "nowhere"`)
+}
+
+func TestSelectLocalKobo(t *testing.T) {
+	b := setupTestBackend(t, "")
+	dbPath := b.SelectedKobo.DbPath
+	mount := setupTmpKobo(t.TempDir(), libraTwoDeviceId)
+
+	assert.NoError(t, b.SelectLocalKobo(dbPath, mount))
+	assert.Equal(t, Kobo{
+		Name:            "Kobo Libra 2",
+		Storage:         32,
+		DisplayPPI:      300,
+		MntPath:         mount,
+		DbPath:          dbPath,
+		Serial:          "NXXXXXXXXXX",
+		FirmwareVersion: "4.30.18838",
+		DeviceID:        "00000000-0000-0000-0000-000000000388",
+	}, b.SelectedKobo)
+	records, err := b.ExportHighlights()
+	assert.NoError(t, err)
+	assert.Len(t, records, 4)
+
+	// A mount without any device details is still used for finding book files
+	bare := t.TempDir()
+	assert.NoError(t, b.SelectLocalKobo(dbPath, bare))
+	assert.Equal(t, Kobo{Name: "Local Database", MntPath: bare, DbPath: dbPath}, b.SelectedKobo)
+
+	err = b.SelectLocalKobo(filepath.Join(t.TempDir(), "missing.sqlite"), "")
+	assert.ErrorContains(t, err, "failed to find a kobo database")
+}
@@ -0,0 +1,349 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	markdownRegionStart = "<!-- noctober:start -->"
+	markdownRegionEnd   = "<!-- noctober:end -->"
+	// markdownMarkupsDirname is the folder within the vault that markup images are copied to
+	markdownMarkupsDirname = "markups"
+)
+
+// markdownDestination writes one Markdown file per book into a folder, such as an Obsidian
+// or Logseq vault. Only the front matter keys and the region between the noctober markers
+// are owned by noctober so anything else a user writes in the file survives a re-export.
+type markdownDestination struct {
+	settings *Settings
+}
+
+func init() {
+	RegisterDestination(MarkdownDestinationName, func(b *Backend) Destination {
+		return &markdownDestination{settings: b.Settings}
+	})
+}
+
+func (d *markdownDestination) Name() string {
+	return MarkdownDestinationName
+}
+
+func (d *markdownDestination) Validate() error {
+	if d.settings.MarkdownVaultPath == "" {
+		return fmt.Errorf("no markdown vault folder was configured")
+	}
+	info, err := os.Stat(d.settings.MarkdownVaultPath)
+	if err != nil {
+		return fmt.Errorf("markdown vault folder is not accessible: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("markdown vault path %s is not a folder", d.settings.MarkdownVaultPath)
+	}
+	return nil
+}
+
+func (d *markdownDestination) SendsWholeBooks() bool {
+	return true
+}
+
+func (d *markdownDestination) Send(ctx context.Context, highlights []Highlight) SyncResult {
+	result := SyncResult{
+		Destination:      MarkdownDestinationName,
+		FirstFailedBatch: -1,
+	}
+	books := map[string][]Highlight{}
+	var order []string
+	for _, highlight := range uniqueHighlights(highlights) {
+		key := highlight.Title
+		if _, ok := books[key]; !ok {
+			order = append(order, key)
+		}
+		books[key] = append(books[key], highlight)
+	}
+	for _, title := range order {
+		if err := ctx.Err(); err != nil {
+			result.Error = err.Error()
+			result.Err = err
+			return result
+		}
+		bookHighlights := books[title]
+		sortByPosition(bookHighlights)
+		if err := copyMarkups(d.settings.MarkdownVaultPath, bookHighlights); err != nil {
+			result.Error = err.Error()
+			result.Err = err
+			return result
+		}
+		path := filepath.Join(d.settings.MarkdownVaultPath, markdownFilename(title))
+		if err := writeMarkdownBook(path, bookHighlights); err != nil {
+			result.Error = err.Error()
+			result.Err = err
+			return result
+		}
+		result.Sent += len(bookHighlights)
+		for _, highlight := range bookHighlights {
+			result.Synced = append(result.Synced, highlight.BookmarkID)
+		}
+	}
+	return result
+}
+
+// writeMarkdownBook creates or updates the file for a single book, leaving anything outside
+// of the managed front matter keys and highlight region untouched
+func writeMarkdownBook(path string, highlights []Highlight) error {
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read existing markdown file %s: %w", path, err)
+	}
+	frontMatter := markdownFrontMatter(highlights[0])
+	region := renderMarkdownRegion(highlights)
+	var doc string
+	if len(existing) == 0 {
+		doc = renderFrontMatter(frontMatter) + "\n" + region + "\n"
+	} else {
+		// Files saved on Windows use CRLF line endings, which are kept once the file is updated
+		doc = string(existing)
+		crlf := strings.Contains(doc, "\r\n")
+		doc = strings.ReplaceAll(doc, "\r\n", "\n")
+		doc = mergeFrontMatter(doc, frontMatter)
+		doc = replaceMarkdownRegion(doc, region)
+		if crlf {
+			doc = strings.ReplaceAll(doc, "\n", "\r\n")
+		}
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(doc), 0666); err != nil {
+		return fmt.Errorf("failed to write markdown file %s: %w", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace markdown file %s: %w", path, err)
+	}
+	return nil
+}
+
+// copyMarkups copies the images of any handwritten markups into the vault so that the
+// Markdown can link to them with a relative path
+func copyMarkups(vault string, highlights []Highlight) error {
+	for _, highlight := range highlights {
+		if highlight.Bookmark == nil || highlight.Bookmark.MarkupPath == "" {
+			continue
+		}
+		dir := filepath.Join(vault, markdownMarkupsDirname)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create markup folder in vault: %w", err)
+		}
+		if err := copyFile(highlight.Bookmark.MarkupPath, filepath.Join(dir, filepath.Base(highlight.Bookmark.MarkupPath))); err != nil {
+			return fmt.Errorf("failed to copy markup into vault: %w", err)
+		}
+	}
+	return nil
+}
+
+func copyFile(source string, dest string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+type frontMatterField struct {
+	key   string
+	value string
+}
+
+func markdownFrontMatter(highlight Highlight) []frontMatterField {
+	book := Content{}
+	if highlight.Book != nil {
+		book = *highlight.Book
+	}
+	contentID := book.ContentID
+	if contentID == "" && highlight.Bookmark != nil {
+		contentID = highlight.Bookmark.VolumeID
+	}
+	return []frontMatterField{
+		{"title", book.Title},
+		{"author", book.Attribution},
+		{"isbn", book.ISBN},
+		{"series", book.Series},
+		{"series_number", book.SeriesNumber},
+		{"last_read", book.DateLastRead},
+		{"kobo_content_id", contentID},
+	}
+}
+
+func renderFrontMatter(fields []frontMatterField) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, field := range fields {
+		fmt.Fprintf(&b, "%s: %s\n", field.key, yamlString(field.value))
+	}
+	b.WriteString("---\n")
+	return b.String()
+}
+
+// mergeFrontMatter updates the keys we manage within existing front matter, keeping any keys
+// a user has added themselves. Files without front matter have it added at the top. doc is
+// expected to use LF line endings.
+func mergeFrontMatter(doc string, fields []frontMatterField) string {
+	if !strings.HasPrefix(doc, "---\n") {
+		return renderFrontMatter(fields) + "\n" + doc
+	}
+	end := strings.Index(doc[4:], "\n---\n")
+	if end == -1 && strings.HasSuffix(doc[4:], "\n---") {
+		// A file holding nothing but front matter may not end with a newline
+		end = len(doc) - 8
+	}
+	if end == -1 {
+		return renderFrontMatter(fields) + "\n" + doc
+	}
+	lines := strings.Split(doc[4:4+end], "\n")
+	written := map[string]bool{}
+	for i, line := range lines {
+		for _, field := range fields {
+			if strings.HasPrefix(line, field.key+":") {
+				lines[i] = fmt.Sprintf("%s: %s", field.key, yamlString(field.value))
+				written[field.key] = true
+			}
+		}
+	}
+	for _, field := range fields {
+		if !written[field.key] {
+			lines = append(lines, fmt.Sprintf("%s: %s", field.key, yamlString(field.value)))
+		}
+	}
+	return "---\n" + strings.Join(lines, "\n") + doc[4+end:]
+}
+
+func replaceMarkdownRegion(doc string, region string) string {
+	start := strings.Index(doc, markdownRegionStart)
+	end := strings.Index(doc, markdownRegionEnd)
+	if start == -1 || end == -1 || end < start {
+		// The markers have been removed so we add a fresh region rather than guess where it was
+		return strings.TrimRight(doc, "\n") + "\n\n" + region + "\n"
+	}
+	return doc[:start] + region + doc[end+len(markdownRegionEnd):]
+}
+
+func renderMarkdownRegion(highlights []Highlight) string {
+	var b strings.Builder
+	b.WriteString(markdownRegionStart)
+	b.WriteString("\n## Highlights\n")
+	chapter := ""
+	for _, highlight := range highlights {
+		// Highlights arrive in reading order so a heading is only needed when the chapter changes
+		if highlight.Bookmark != nil && highlight.Bookmark.ChapterTitle != "" && highlight.Bookmark.ChapterTitle != chapter {
+			chapter = highlight.Bookmark.ChapterTitle
+			fmt.Fprintf(&b, "\n### %s\n", chapter)
+		}
+		b.WriteString("\n")
+		text := ""
+		annotation := ""
+		markup := ""
+		if highlight.Bookmark != nil {
+			text = NormaliseText(highlight.Bookmark.Text)
+			annotation = stripTags(highlight.Bookmark.Annotation)
+			markup = highlight.Bookmark.MarkupPath
+		}
+		if text == "" && annotation == "" && markup == "" {
+			text = highlight.Content
+		}
+		if text != "" {
+			fmt.Fprintf(&b, "> %s\n", text)
+		}
+		if highlight.Bookmark != nil && highlight.Bookmark.Context != "" {
+			fmt.Fprintf(&b, ">\n> *Context: %s*\n", highlight.Bookmark.Context)
+		}
+		if annotation != "" {
+			if text != "" {
+				b.WriteString(">\n")
+			}
+			for _, line := range strings.Split(annotation, "\n") {
+				fmt.Fprintf(&b, "> — *%s*\n", strings.TrimSpace(line))
+			}
+		}
+		if markup != "" {
+			if text != "" || annotation != "" {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "![Handwritten markup](%s/%s)\n", markdownMarkupsDirname, filepath.Base(markup))
+		}
+		if len(highlight.Tags) > 0 {
+			var hashtags []string
+			for _, tag := range highlight.Tags {
+				hashtags = append(hashtags, "#"+tag)
+			}
+			fmt.Fprintf(&b, "\n%s\n", strings.Join(hashtags, " "))
+		}
+	}
+	b.WriteString("\n")
+	b.WriteString(markdownRegionEnd)
+	return b.String()
+}
+
+// stripTags removes .tag style words from an annotation as they are rendered as hashtags instead
+func stripTags(annotation string) string {
+	var words []string
+	for _, word := range strings.Split(strings.TrimSpace(annotation), " ") {
+		if strings.HasPrefix(word, ".") {
+			continue
+		}
+		words = append(words, word)
+	}
+	return strings.TrimSpace(strings.Join(words, " "))
+}
+
+// yamlString quotes s as a YAML double quoted scalar. Control characters are escaped since
+// a newline in a title would otherwise end the front matter value early.
+func yamlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		case r == 0x85 || r == 0x2028 || r == 0x2029:
+			// YAML treats these as line breaks too
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+var markdownFilenameReplacer = strings.NewReplacer(
+	"/", "_", `\`, "_", ":", "_", "*", "_", "?", "_", `"`, "_", "<", "_", ">", "_", "|", "_",
+)
+
+func markdownFilename(title string) string {
+	name := strings.TrimSpace(markdownFilenameReplacer.Replace(title))
+	if name == "" {
+		name = "Untitled"
+	}
+	return name + ".md"
+}
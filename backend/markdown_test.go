@@ -0,0 +1,224 @@
+package backend
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func markdownTestHighlights() []Highlight {
+	book := &Content{
+		ContentID:    "file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub",
+		Title:        "Dune",
+		Attribution:  "Frank Herbert",
+		ISBN:         "9780441013593",
+		Series:       "Dune",
+		SeriesNumber: "1",
+		DateLastRead: "2023-03-02T21:14:00Z",
+	}
+	return []Highlight{
+		{
+			Content:    "Second",
+			Title:      "Dune - Frank Herbert",
+			Tags:       []string{"quote"},
+			BookmarkID: "b",
+			Bookmark:   &Bookmark{BookmarkID: "b", Text: "Second", Annotation: "So \"good\" .quote", ChapterProgress: 0.8, Position: 0.8},
+			Book:       book,
+		},
+		{
+			Content:    "First",
+			Title:      "Dune - Frank Herbert",
+			BookmarkID: "a",
+			Bookmark:   &Bookmark{BookmarkID: "a", Text: "First", ChapterProgress: 0.2, Position: 0.2},
+			Book:       book,
+		},
+	}
+}
+
+func TestMarkdownDestination_WritesOneFilePerBook(t *testing.T) {
+	vault := t.TempDir()
+	d := &markdownDestination{settings: &Settings{MarkdownVaultPath: vault}}
+	assert.NoError(t, d.Validate())
+	result := d.Send(context.Background(), markdownTestHighlights())
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 2, result.Sent)
+
+	actual, err := os.ReadFile(filepath.Join(vault, "Dune - Frank Herbert.md"))
+	assert.NoError(t, err)
+	expected := `---
+title: "Dune"
+author: "Frank Herbert"
+isbn: "9780441013593"
+series: "Dune"
+series_number: "1"
+last_read: "2023-03-02T21:14:00Z"
+kobo_content_id: "file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub"
+---
+
+<!-- noctober:start -->
+## Highlights
+
+> First
+
+> Second
+>
+> — *So "good"*
+
+#quote
+
+<!-- noctober:end -->
+`
+	assert.Equal(t, expected, string(actual))
+}
+
+func TestMarkdownDestination_KeepsHandEdits(t *testing.T) {
+	vault := t.TempDir()
+	path := filepath.Join(vault, "Dune - Frank Herbert.md")
+	existing := `---
+title: "Old title"
+rating: 5
+---
+
+My own thoughts before the highlights.
+
+<!-- noctober:start -->
+stale highlights
+<!-- noctober:end -->
+
+And some afterwards.
+`
+	assert.NoError(t, os.WriteFile(path, []byte(existing), 0666))
+	d := &markdownDestination{settings: &Settings{MarkdownVaultPath: vault}}
+	result := d.Send(context.Background(), markdownTestHighlights()[1:])
+	assert.NoError(t, result.Err)
+
+	actual, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	expected := `---
+title: "Dune"
+rating: 5
+author: "Frank Herbert"
+isbn: "9780441013593"
+series: "Dune"
+series_number: "1"
+last_read: "2023-03-02T21:14:00Z"
+kobo_content_id: "file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub"
+---
+
+My own thoughts before the highlights.
+
+<!-- noctober:start -->
+## Highlights
+
+> First
+
+<!-- noctober:end -->
+
+And some afterwards.
+`
+	assert.Equal(t, expected, string(actual))
+}
+
+func TestMarkdownDestination_KeepsHandEditsWithCRLF(t *testing.T) {
+	vault := t.TempDir()
+	path := filepath.Join(vault, "Dune - Frank Herbert.md")
+	existing := "---\r\ntitle: \"Old title\"\r\nrating: 5\r\n---\r\n\r\nMy own thoughts.\r\n"
+	assert.NoError(t, os.WriteFile(path, []byte(existing), 0666))
+	d := &markdownDestination{settings: &Settings{MarkdownVaultPath: vault}}
+	result := d.Send(context.Background(), markdownTestHighlights()[1:])
+	assert.NoError(t, result.Err)
+
+	actual, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	doc := string(actual)
+	assert.Equal(t, 1, strings.Count(doc, "rating: 5"))
+	assert.Equal(t, 2, strings.Count(doc, "---\r\n"), "the existing front matter is updated rather than a second block added")
+	assert.True(t, strings.HasPrefix(doc, "---\r\ntitle: \"Dune\"\r\nrating: 5\r\n"))
+	assert.Contains(t, doc, "My own thoughts.\r\n")
+	assert.NotContains(t, strings.ReplaceAll(doc, "\r\n", ""), "\n", "line endings stay CRLF")
+}
+
+func TestMergeFrontMatter_ClosedAtEndOfFile(t *testing.T) {
+	fields := []frontMatterField{{"title", "Dune"}}
+	merged := mergeFrontMatter("---\ntitle: \"Old title\"\nrating: 5\n---", fields)
+	assert.Equal(t, "---\ntitle: \"Dune\"\nrating: 5\n---", merged)
+	assert.Equal(t, "---\ntitle: \"Dune\"\n---\n\nNotes", mergeFrontMatter("Notes", fields))
+}
+
+func TestRenderMarkdownRegion_ChapterHeadings(t *testing.T) {
+	highlights := []Highlight{
+		{Bookmark: &Bookmark{BookmarkID: "a", Text: "First", ChapterTitle: "Book One: Dune", ChapterIndex: 0, ChapterProgress: 0.5, Position: 0.5}},
+		{Bookmark: &Bookmark{BookmarkID: "b", Text: "Second", ChapterTitle: "Book Two: Muad'Dib", ChapterIndex: 1, ChapterProgress: 0.8, Position: 1.8}},
+		{Bookmark: &Bookmark{BookmarkID: "c", Text: "Third", ChapterTitle: "Book One: Dune", ChapterIndex: 0, ChapterProgress: 0.1, Position: 0.1}},
+	}
+	sortByPosition(highlights)
+	expected := `<!-- noctober:start -->
+## Highlights
+
+### Book One: Dune
+
+> Third
+
+> First
+
+### Book Two: Muad'Dib
+
+> Second
+
+<!-- noctober:end -->`
+	assert.Equal(t, expected, renderMarkdownRegion(highlights))
+}
+
+func TestMarkdownDestination_CopiesMarkups(t *testing.T) {
+	vault := t.TempDir()
+	markup := filepath.Join(t.TempDir(), "m1.png")
+	assert.NoError(t, os.WriteFile(markup, []byte("png"), 0666))
+	d := &markdownDestination{settings: &Settings{MarkdownVaultPath: vault}}
+	highlights := []Highlight{
+		{Content: "Placeholder for handwritten markup", Title: "Dune - Frank Herbert", BookmarkID: "m1", Bookmark: &Bookmark{BookmarkID: "m1", Type: BookmarkTypeMarkup, MarkupPath: markup}},
+	}
+	result := d.Send(context.Background(), highlights)
+	assert.NoError(t, result.Err)
+	assert.FileExists(t, filepath.Join(vault, "markups", "m1.png"))
+
+	expected := `<!-- noctober:start -->
+## Highlights
+
+![Handwritten markup](markups/m1.png)
+
+<!-- noctober:end -->`
+	assert.Equal(t, expected, renderMarkdownRegion(highlights))
+}
+
+func TestRenderMarkdownRegion_Context(t *testing.T) {
+	highlights := []Highlight{
+		{Bookmark: &Bookmark{BookmarkID: "a", Text: "mind-killer", Context: "Fear is the mind-killer."}},
+	}
+	expected := `<!-- noctober:start -->
+## Highlights
+
+> mind-killer
+>
+> *Context: Fear is the mind-killer.*
+
+<!-- noctober:end -->`
+	assert.Equal(t, expected, renderMarkdownRegion(highlights))
+}
+
+func TestMarkdownDestination_RequiresVault(t *testing.T) {
+	d := &markdownDestination{settings: &Settings{}}
+	assert.Error(t, d.Validate())
+	d.settings.MarkdownVaultPath = filepath.Join(t.TempDir(), "missing")
+	assert.Error(t, d.Validate())
+}
+
+func TestYamlString(t *testing.T) {
+	assert.Equal(t, `"Dune"`, yamlString("Dune"))
+	assert.Equal(t, `"The \"Best\" of C:\\Books"`, yamlString(`The "Best" of C:\Books`))
+	// Anything that could end the value early or corrupt the front matter is escaped
+	assert.Equal(t, `"Dune\nMessiah\r\tPart\x01 Two\u2028"`, yamlString("Dune\nMessiah\r\tPart\x01 Two\u2028"))
+}
@@ -0,0 +1,271 @@
+package backend
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"log/slog"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+const (
+	markupsDirname = "october/markups"
+	// markupMaxDimension bounds the size of a rendered markup. Pages are the size of the
+	// device's screen, the largest of which is 1404x1872 on the Elipsa 2E, so anything much
+	// bigger than that isn't a real markup.
+	markupMaxDimension = 2048
+	// markupMaxStrokeWidth is far thicker than any line the stylus can draw
+	markupMaxStrokeWidth = 100
+)
+
+// markupSourceDir is where stylus devices such as the Elipsa and Sage keep handwritten markups.
+// Each markup is an SVG of the pen strokes named after its bookmark, usually alongside a JPG
+// of the page that it was drawn over.
+var markupSourceDir = filepath.Join(".kobo", "markups")
+
+// extractMarkups renders the markups on the selected device to PNGs in the data directory so
+// that they can be linked to or copied into exports
+func (b *Backend) extractMarkups(bookmarks []Bookmark) {
+	source := filepath.Join(b.SelectedKobo.MntPath, markupSourceDir)
+	if !hasMarkups(bookmarks) || !isDir(source) {
+		return
+	}
+	dir, err := LocateDataFile(markupsDirname, b.portable)
+	if err == nil {
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err != nil {
+		b.logger.Error("Failed to create markup directory so markups won't be exported",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	extractMarkups(bookmarks, source, dir, b.logger)
+}
+
+// previewMarkups fills in where each markup's image would be saved by extractMarkups without
+// rendering or writing anything, so that dry runs leave the disk untouched
+func (b *Backend) previewMarkups(bookmarks []Bookmark) {
+	source := filepath.Join(b.SelectedKobo.MntPath, markupSourceDir)
+	if !hasMarkups(bookmarks) || !isDir(source) {
+		return
+	}
+	dir, err := DataFilePath(markupsDirname, b.portable)
+	if err != nil {
+		b.logger.Error("Failed to locate markup directory so markups won't be previewed",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	for i, bookmark := range bookmarks {
+		if bookmark.kind() != BookmarkTypeMarkup {
+			continue
+		}
+		if isFile(filepath.Join(source, bookmark.BookmarkID+".svg")) || isFile(filepath.Join(source, bookmark.BookmarkID+".jpg")) {
+			bookmarks[i].MarkupPath = filepath.Join(dir, bookmark.BookmarkID+".png")
+		}
+	}
+}
+
+// extractMarkups fills in the rendered image of each markup bookmark. Images that are newer
+// than the markup's files are reused. A markup that can't be rendered has its files copied
+// as they are instead, and one without any files is still synced, just without an image.
+func extractMarkups(bookmarks []Bookmark, source string, dir string, logger *slog.Logger) {
+	for i, bookmark := range bookmarks {
+		if bookmark.kind() != BookmarkTypeMarkup {
+			continue
+		}
+		svgPath := filepath.Join(source, bookmark.BookmarkID+".svg")
+		jpgPath := filepath.Join(source, bookmark.BookmarkID+".jpg")
+		if !isFile(svgPath) {
+			svgPath = ""
+		}
+		if !isFile(jpgPath) {
+			jpgPath = ""
+		}
+		if svgPath == "" && jpgPath == "" {
+			logger.Warn("No files were found for markup",
+				slog.String("bookmark_id", bookmark.BookmarkID),
+			)
+			continue
+		}
+		dest := filepath.Join(dir, bookmark.BookmarkID+".png")
+		if isNewer(dest, svgPath, jpgPath) {
+			bookmarks[i].MarkupPath = dest
+			continue
+		}
+		err := renderMarkup(svgPath, jpgPath, dest)
+		if err == nil {
+			bookmarks[i].MarkupPath = dest
+			continue
+		}
+		logger.Warn("Failed to render markup so copying its files as they are",
+			slog.String("bookmark_id", bookmark.BookmarkID),
+			slog.String("error", err.Error()),
+		)
+		original := svgPath
+		if original == "" {
+			original = jpgPath
+		}
+		dest = filepath.Join(dir, filepath.Base(original))
+		if err := copyFile(original, dest); err != nil {
+			logger.Warn("Failed to copy markup",
+				slog.String("bookmark_id", bookmark.BookmarkID),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		bookmarks[i].MarkupPath = dest
+	}
+}
+
+// isNewer reports whether path exists and was modified after every one of the sources, which
+// may be empty when they don't exist
+func isNewer(path string, sources ...string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	for _, source := range sources {
+		if source == "" {
+			continue
+		}
+		sourceInfo, err := os.Stat(source)
+		if err != nil || !info.ModTime().After(sourceInfo.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasMarkups(bookmarks []Bookmark) bool {
+	for _, bookmark := range bookmarks {
+		if bookmark.kind() == BookmarkTypeMarkup {
+			return true
+		}
+	}
+	return false
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// renderMarkup draws the strokes from svgPath over the page in jpgPath and writes the result to
+// dest as a PNG. Either file may be empty but not both.
+func renderMarkup(svgPath string, jpgPath string, dest string) error {
+	var page image.Image
+	if jpgPath != "" {
+		var err error
+		if page, err = decodeMarkupPage(jpgPath); err != nil {
+			return err
+		}
+	}
+	var icon *oksvg.SvgIcon
+	if svgPath != "" {
+		f, err := os.Open(svgPath)
+		if err != nil {
+			return fmt.Errorf("failed to open markup strokes: %w", err)
+		}
+		icon, err = oksvg.ReadIconStream(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to parse markup strokes %s: %w", svgPath, err)
+		}
+		for _, path := range icon.SVGPaths {
+			if !(path.LineWidth <= markupMaxStrokeWidth) {
+				return fmt.Errorf("markup strokes %s are %g wide which is more than a stylus can draw", svgPath, path.LineWidth)
+			}
+		}
+	}
+	var bounds image.Rectangle
+	if page != nil {
+		bounds = page.Bounds()
+	} else {
+		width, height := icon.ViewBox.W, icon.ViewBox.H
+		if !(width > 0 && height > 0) {
+			return fmt.Errorf("markup strokes %s don't have a size", svgPath)
+		}
+		// Drawings without a page are shrunk to fit rather than taking up however much memory
+		// the file says they need
+		scale := math.Min(1, math.Min(markupMaxDimension/width, markupMaxDimension/height))
+		bounds = image.Rect(0, 0, max(int(math.Ceil(width*scale)), 1), max(int(math.Ceil(height*scale)), 1))
+	}
+	canvas := image.NewRGBA(bounds)
+	if page != nil {
+		draw.Draw(canvas, bounds, page, bounds.Min, draw.Src)
+	} else {
+		draw.Draw(canvas, bounds, image.White, image.Point{}, draw.Src)
+	}
+	if icon != nil {
+		icon.SetTarget(float64(bounds.Min.X), float64(bounds.Min.Y), float64(bounds.Dx()), float64(bounds.Dy()))
+		scanner := rasterx.NewScannerGV(bounds.Dx(), bounds.Dy(), canvas, bounds)
+		icon.Draw(rasterx.NewDasher(bounds.Dx(), bounds.Dy(), scanner), 1)
+	}
+
+	tmpPath := dest + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create markup image: %w", err)
+	}
+	if err := png.Encode(out, canvas); err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to encode markup image: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write markup image: %w", err)
+	}
+	return os.Rename(tmpPath, dest)
+}
+
+// decodeMarkupPage reads the page that a markup was drawn over, checking its size before
+// decoding so that an oversized image is never loaded
+func decodeMarkupPage(jpgPath string) (image.Image, error) {
+	f, err := os.Open(jpgPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open markup page: %w", err)
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode markup page %s: %w", jpgPath, err)
+	}
+	if config.Width > markupMaxDimension || config.Height > markupMaxDimension {
+		return nil, fmt.Errorf("markup page %s is %dx%d which is larger than any kobo screen", jpgPath, config.Width, config.Height)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, fmt.Errorf("failed to read markup page: %w", err)
+	}
+	page, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode markup page %s: %w", jpgPath, err)
+	}
+	return page, nil
+}
+
+// markupURL links to a rendered markup in a way that Notado will show as a link
+func markupURL(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		// Windows paths start with a drive letter rather than a slash
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
@@ -0,0 +1,141 @@
+package backend
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testMarkupSVG = `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="20" height="10" viewBox="0 0 20 10">
+  <g>
+    <path d="M 2 5 L 18 5" stroke="#000000" stroke-width="2" fill="none"/>
+    <path d="M 2 1 L 18 1" style="stroke:none"/>
+  </g>
+</svg>`
+
+func writeTestPage(t *testing.T, path string, width int, height int) {
+	t.Helper()
+	page := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(page, page.Bounds(), image.White, image.Point{}, draw.Src)
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	assert.NoError(t, jpeg.Encode(f, page, nil))
+	assert.NoError(t, f.Close())
+}
+
+func readTestPNG(t *testing.T, path string) image.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	img, err := png.Decode(f)
+	assert.NoError(t, err)
+	return img
+}
+
+func isDark(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r < 0x4000 && g < 0x4000 && b < 0x4000
+}
+
+func TestRenderMarkup_DrawsStrokesOverPage(t *testing.T) {
+	dir := t.TempDir()
+	svgPath := filepath.Join(dir, "markup.svg")
+	jpgPath := filepath.Join(dir, "markup.jpg")
+	assert.NoError(t, os.WriteFile(svgPath, []byte(testMarkupSVG), 0666))
+	// The page is twice the size of the drawing so strokes have to be scaled up to match
+	writeTestPage(t, jpgPath, 40, 20)
+
+	dest := filepath.Join(dir, "markup.png")
+	assert.NoError(t, renderMarkup(svgPath, jpgPath, dest))
+	img := readTestPNG(t, dest)
+	assert.Equal(t, image.Rect(0, 0, 40, 20), img.Bounds())
+	assert.True(t, isDark(img.At(20, 10)))
+	assert.False(t, isDark(img.At(20, 2)))
+	assert.False(t, isDark(img.At(1, 10)))
+
+	// Without a page the strokes are drawn on a blank one the size of the drawing
+	assert.NoError(t, renderMarkup(svgPath, "", dest))
+	img = readTestPNG(t, dest)
+	assert.Equal(t, image.Rect(0, 0, 20, 10), img.Bounds())
+	assert.True(t, isDark(img.At(10, 5)))
+}
+
+func TestRenderMarkup_RejectsAbsurdSizes(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "markup.png")
+
+	// A drawing without a page is shrunk to fit instead of allocating whatever it asks for
+	huge := filepath.Join(dir, "huge.svg")
+	assert.NoError(t, os.WriteFile(huge, []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="100000" height="50000"><path d="M 0 0 L 100000 50000" stroke="#000000" fill="none"/></svg>`), 0666))
+	assert.NoError(t, renderMarkup(huge, "", dest))
+	assert.Equal(t, image.Rect(0, 0, markupMaxDimension, markupMaxDimension/2), readTestPNG(t, dest).Bounds())
+
+	thick := filepath.Join(dir, "thick.svg")
+	assert.NoError(t, os.WriteFile(thick, []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="20" height="10"><path d="M 2 5 L 18 5" stroke="#000000" stroke-width="100000" fill="none"/></svg>`), 0666))
+	assert.Error(t, renderMarkup(thick, "", dest))
+
+	page := filepath.Join(dir, "page.jpg")
+	writeTestPage(t, page, markupMaxDimension+1, 10)
+	assert.Error(t, renderMarkup("", page, dest))
+}
+
+func TestExtractMarkups(t *testing.T) {
+	source := t.TempDir()
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(source, "m1.svg"), []byte(testMarkupSVG), 0666))
+	bookmarks := []Bookmark{
+		{BookmarkID: "m1", Type: BookmarkTypeMarkup},
+		{BookmarkID: "m2", Type: BookmarkTypeMarkup},
+		{BookmarkID: "h1", Text: "Fear is the mind-killer"},
+	}
+
+	extractMarkups(bookmarks, source, dir, slog.New(&discardHandler{}))
+	assert.Equal(t, filepath.Join(dir, "m1.png"), bookmarks[0].MarkupPath)
+	assert.FileExists(t, bookmarks[0].MarkupPath)
+	// A markup without any files is still synced but has nothing to link to
+	assert.Empty(t, bookmarks[1].MarkupPath)
+	assert.Empty(t, bookmarks[2].MarkupPath)
+
+	// Images that are newer than the markup aren't rendered again
+	rendered := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(bookmarks[0].MarkupPath, rendered, rendered))
+	extractMarkups(bookmarks, source, dir, slog.New(&discardHandler{}))
+	info, err := os.Stat(bookmarks[0].MarkupPath)
+	assert.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(rendered))
+}
+
+func TestExtractMarkups_CopiesWhatCantBeRendered(t *testing.T) {
+	source := t.TempDir()
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(source, "m1.svg"), []byte(`<svg xmlns="http://www.w3.org/2000/svg"><path d="M 0 0 L 1 1" stroke="#000000"/></svg>`), 0666))
+	bookmarks := []Bookmark{{BookmarkID: "m1", Type: BookmarkTypeMarkup}}
+
+	extractMarkups(bookmarks, source, dir, slog.New(&discardHandler{}))
+	assert.Equal(t, filepath.Join(dir, "m1.svg"), bookmarks[0].MarkupPath)
+	assert.FileExists(t, bookmarks[0].MarkupPath)
+}
+
+func TestBuildPayload_LinksMarkups(t *testing.T) {
+	bookmarks := []Bookmark{
+		{BookmarkID: "m1", VolumeID: "file:///mnt/onboard/dune.epub", Type: BookmarkTypeMarkup, DateCreated: "2023-03-02T21:00:00.000", MarkupPath: "/data/october/markups/m1.png"},
+		{BookmarkID: "m2", VolumeID: "file:///mnt/onboard/dune.epub", Type: BookmarkTypeMarkup, DateCreated: "2023-03-02T21:00:00.000", Text: "the mind-killer", MarkupPath: "/data/october/markups/m2.png"},
+		{BookmarkID: "m3", VolumeID: "file:///mnt/onboard/dune.epub", Type: BookmarkTypeMarkup, DateCreated: "2023-03-02T21:00:00.000"},
+	}
+	payload, err := BuildPayload(bookmarks, map[string]Content{}, slog.New(&discardHandler{}))
+	assert.NoError(t, err)
+	assert.Len(t, payload[0].Highlights, 2)
+	assert.Equal(t, "Placeholder for handwritten markup saved at file:///data/october/markups/m1.png", payload[0].Highlights[0].Content)
+	assert.Equal(t, "the mind-killer (handwritten markup saved at file:///data/october/markups/m2.png)", payload[0].Highlights[1].Content)
+}
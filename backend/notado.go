@@ -2,6 +2,7 @@ package backend
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,6 +16,7 @@ import (
 
 const (
 	HIGHLIGHT_REQUEST_BATCH_MAX = 2000
+	NOTADO_GRAPHQL_URL          = "https://notado.app/graphql"
 )
 
 type Response struct {
@@ -28,25 +30,70 @@ type Highlight struct {
 	Created string   `json:"created,omitempty"`
 	Tags    []string `json:"tags,omitempty"`
 	Author  string   `json:"author,omitempty"`
+	// The following link a highlight back to the bookmark and book it was built from for the
+	// benefit of other destinations and are never sent to Notado
+	BookmarkID string    `json:"-"`
+	Bookmark   *Bookmark `json:"-"`
+	Book       *Content  `json:"-"`
 }
 
 type Notado struct {
 	logger    *slog.Logger
 	UserAgent string
+	// The following fall back to sensible defaults when left unset
+	endpoint       string
+	maxRetries     int
+	retryBaseDelay time.Duration
+	client         *http.Client
+	sleep          func(time.Duration)
 }
 
-func (n *Notado) SendBookmarks(payloads []Response, token string) (int, error) {
-	// Flatten all highlights from all payloads into a single slice
-	var allHighlights []Highlight
+// BatchResult records the outcome of sending a single batch of highlights
+type BatchResult struct {
+	Batch    int    `json:"batch"`
+	Count    int    `json:"count"`
+	Attempts int    `json:"attempts"`
+	Sent     bool   `json:"sent"`
+	Error    string `json:"error,omitempty"`
+}
+
+// SendResult describes how far a sync made it. Batches are sent in order and sending stops
+// at the first batch that fails for good so that a rerun can pick up from FirstFailedBatch.
+type SendResult struct {
+	Sent             int           `json:"sent"`
+	Batches          []BatchResult `json:"batches"`
+	FirstFailedBatch int           `json:"first_failed_batch"`
+}
+
+// SetEndpoint points the client at a different GraphQL endpoint, such as a staging
+// instance or a local stand-in. An empty endpoint restores the default.
+func (n *Notado) SetEndpoint(endpoint string) {
+	n.endpoint = endpoint
+}
+
+func (n *Notado) SendBookmarks(payloads []Response, token string) (SendResult, error) {
+	return n.sendPayloads(context.Background(), payloads, token)
+}
+
+func (n *Notado) sendPayloads(ctx context.Context, payloads []Response, token string) (SendResult, error) {
+	var batches [][]Highlight
 	for _, payload := range payloads {
-		allHighlights = append(allHighlights, payload.Highlights...)
+		if len(payload.Highlights) > 0 {
+			batches = append(batches, payload.Highlights)
+		}
 	}
-
-	if len(allHighlights) == 0 {
-		n.logger.Info("No highlights to send to Notado")
-		return 0, nil
+	r := retrier{
+		logger:     n.logger,
+		maxRetries: n.maxRetries,
+		baseDelay:  n.retryBaseDelay,
+		sleep:      n.sleep,
 	}
+	return sendBatches(ctx, r, "Notado", batches, func(batch []Highlight) (int, error) {
+		return n.sendBatch(ctx, batch, token)
+	})
+}
 
+func (n *Notado) sendBatch(ctx context.Context, highlights []Highlight, token string) (int, error) {
 	// Create GraphQL mutation payload
 	graphqlPayload := struct {
 		Query     string      `json:"query"`
@@ -58,7 +105,7 @@ func (n *Notado) SendBookmarks(payloads []Response, token string) (int, error) {
 		Variables: struct {
 			Notes []Highlight `json:"notes"`
 		}{
-			Notes: allHighlights,
+			Notes: highlights,
 		},
 	}
 
@@ -67,8 +114,15 @@ func (n *Notado) SendBookmarks(payloads []Response, token string) (int, error) {
 		return 0, fmt.Errorf("failed to marshal GraphQL payload: %+v", err)
 	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest(http.MethodPost, "https://notado.app/graphql", bytes.NewBuffer(data))
+	client := n.client
+	if client == nil {
+		client = &http.Client{}
+	}
+	endpoint := n.endpoint
+	if endpoint == "" {
+		endpoint = NOTADO_GRAPHQL_URL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(data))
 	if err != nil {
 		return 0, fmt.Errorf("failed to construct request: %+v", err)
 	}
@@ -79,29 +133,163 @@ func (n *Notado) SendBookmarks(payloads []Response, token string) (int, error) {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return 0, fmt.Errorf("failed to send request to Notado: %+v", err)
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, &retryableError{err: fmt.Errorf("failed to send request to Notado: %w", err)}
 	}
 	defer resp.Body.Close()
 
+	body, readErr := io.ReadAll(resp.Body)
+
 	if resp.StatusCode != 200 {
-		body, err := io.ReadAll(resp.Body)
-		if err == nil {
+		if readErr == nil {
 			n.logger.Error("Received a non-200 response from Notado",
 				slog.Int("status_code", resp.StatusCode),
 				slog.String("response", string(body)),
 			)
 		}
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			return 0, &NotadoAuthError{StatusCode: resp.StatusCode}
+		case resp.StatusCode == http.StatusTooManyRequests:
+			return 0, &retryableError{
+				err:        fmt.Errorf("received a non-200 status code from Notado: code %d", resp.StatusCode),
+				retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			}
+		case resp.StatusCode >= 500:
+			return 0, &retryableError{
+				err:        &NotadoServerError{StatusCode: resp.StatusCode},
+				retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			}
+		case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnprocessableEntity:
+			// GraphQL servers commonly reject malformed variables with a 400 and an errors array
+			if gqlErr := parseGraphQLErrors(body, highlights); gqlErr != nil {
+				return 0, gqlErr
+			}
+			return 0, &NotadoValidationError{NoteIndex: -1, Message: strings.TrimSpace(string(body))}
+		}
 		return 0, fmt.Errorf("received a non-200 status code from Notado: code %d", resp.StatusCode)
 	}
+	if readErr != nil {
+		return 0, &retryableError{err: fmt.Errorf("failed to read response from Notado: %w", readErr)}
+	}
 
-	// Optionally, you could parse the GraphQL response here to check for errors
-	// For now, we'll assume success if we get a 200 status code
+	return parseImportResponse(body, highlights)
+}
 
-	n.logger.Info("Successfully sent bookmarks to Notado",
-		slog.Int("highlight_count", len(allHighlights)),
-	)
+// parseImportResponse checks the result of an importNotes mutation, as Notado will happily
+// return a 200 status code alongside a list of errors explaining why nothing was imported
+func parseImportResponse(body []byte, highlights []Highlight) (int, error) {
+	var gqlResp struct {
+		Data struct {
+			ImportNotes json.RawMessage `json:"importNotes"`
+		} `json:"data"`
+		Errors []graphqlError `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &gqlResp); err != nil {
+		return 0, &NotadoServerError{StatusCode: 200, Message: fmt.Sprintf("failed to parse response: %s", err)}
+	}
+	if len(gqlResp.Errors) > 0 {
+		return 0, classifyGraphQLError(gqlResp.Errors[0], highlights)
+	}
+	result := gqlResp.Data.ImportNotes
+	if len(result) == 0 || string(result) == "null" {
+		return 0, &NotadoServerError{StatusCode: 200, Message: "response did not contain an importNotes result"}
+	}
+	// The mutation result is a scalar so we accept a count, a boolean or a list of created notes
+	var count int
+	if err := json.Unmarshal(result, &count); err == nil {
+		return count, nil
+	}
+	var ok bool
+	if err := json.Unmarshal(result, &ok); err == nil {
+		if !ok {
+			return 0, &NotadoServerError{StatusCode: 200, Message: "notes were not imported"}
+		}
+		return len(highlights), nil
+	}
+	var created []json.RawMessage
+	if err := json.Unmarshal(result, &created); err == nil {
+		return len(created), nil
+	}
+	return len(highlights), nil
+}
 
-	return len(allHighlights), nil
+func parseGraphQLErrors(body []byte, highlights []Highlight) error {
+	var gqlResp struct {
+		Errors []graphqlError `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &gqlResp); err != nil || len(gqlResp.Errors) == 0 {
+		return nil
+	}
+	return classifyGraphQLError(gqlResp.Errors[0], highlights)
+}
+
+// notadoDestination adapts the Notado client to the Destination interface, pulling the access
+// token from settings at the time of each sync
+type notadoDestination struct {
+	notado   *Notado
+	settings *Settings
+}
+
+func init() {
+	RegisterDestination(NotadoDestinationName, func(b *Backend) Destination {
+		return &notadoDestination{notado: b.Notado, settings: b.Settings}
+	})
+}
+
+func (d *notadoDestination) Name() string {
+	return NotadoDestinationName
+}
+
+func (d *notadoDestination) Validate() error {
+	if d.settings.NotadoToken == "" {
+		return &MissingTokenError{Destination: NotadoDestinationName}
+	}
+	return nil
+}
+
+func (d *notadoDestination) Send(ctx context.Context, highlights []Highlight) SyncResult {
+	var payloads []Response
+	for start := 0; start < len(highlights); start += HIGHLIGHT_REQUEST_BATCH_MAX {
+		end := min(start+HIGHLIGHT_REQUEST_BATCH_MAX, len(highlights))
+		payloads = append(payloads, Response{Highlights: highlights[start:end]})
+	}
+	sendResult, err := d.notado.sendPayloads(ctx, payloads, d.settings.NotadoToken)
+	result := SyncResult{
+		Destination:      NotadoDestinationName,
+		Sent:             sendResult.Sent,
+		Batches:          sendResult.Batches,
+		FirstFailedBatch: sendResult.FirstFailedBatch,
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.Err = err
+		for id := range sendResult.SyncedBookmarkIDs(payloads) {
+			result.Synced = append(result.Synced, id)
+		}
+	}
+	return result
+}
+
+// SyncedBookmarkIDs returns the IDs of every bookmark whose highlights all made it into
+// batches that were successfully sent. A long highlight may be split across two batches
+// in which case it only counts as synced if both halves were sent.
+func (r SendResult) SyncedBookmarkIDs(payloads []Response) map[string]bool {
+	var batchIDs [][]string
+	for _, payload := range payloads {
+		// Empty payloads are never sent so they don't take up a batch
+		if len(payload.Highlights) == 0 {
+			continue
+		}
+		ids := make([]string, 0, len(payload.Highlights))
+		for _, highlight := range payload.Highlights {
+			ids = append(ids, highlight.BookmarkID)
+		}
+		batchIDs = append(batchIDs, ids)
+	}
+	return r.syncedBookmarkIDs(batchIDs)
 }
 
 func BuildPayload(bookmarks []Bookmark, contentIndex map[string]Content, logger *slog.Logger) ([]Response, error) {
@@ -110,7 +298,9 @@ func BuildPayload(bookmarks []Bookmark, contentIndex map[string]Content, logger
 	for count, entry := range bookmarks {
 		// If max payload size is reached, start building another batch which will be sent separately
 		if count > 0 && (count%HIGHLIGHT_REQUEST_BATCH_MAX == 0) {
-			fmt.Println(count / HIGHLIGHT_REQUEST_BATCH_MAX)
+			logger.Debug("Starting a new batch of highlights",
+				slog.Int("batch", count/HIGHLIGHT_REQUEST_BATCH_MAX),
+			)
 			payloads = append(payloads, currentBatch)
 			currentBatch = Response{}
 		}
@@ -157,6 +347,19 @@ func BuildPayload(bookmarks []Bookmark, contentIndex map[string]Content, logger
 			createdAt = t.Format("2006-01-02T15:04:05-07:00")
 		}
 		text := NormaliseText(entry.Text)
+		if entry.Context != "" {
+			// A highlight of a word or two means little on its own so the note holds the sentence
+			// around it instead, with the highlight itself picked out
+			text = markHighlight(entry.Context, text)
+		}
+		if entry.MarkupPath != "" {
+			// Notado can't hold images so handwritten markups link to where they were saved instead
+			if text == "" {
+				text = fmt.Sprintf("Placeholder for handwritten markup saved at %s", markupURL(entry.MarkupPath))
+			} else {
+				text = fmt.Sprintf("%s (handwritten markup saved at %s)", text, markupURL(entry.MarkupPath))
+			}
+		}
 		if entry.Annotation != "" && text == "" {
 			// I feel like this state probably shouldn't be possible but we'll handle it anyway
 			// since it's useful to surface annotations, regardless of highlights. We put a
@@ -206,12 +409,15 @@ func BuildPayload(bookmarks []Bookmark, contentIndex map[string]Content, logger
 			}
 
 			highlight := Highlight{
-				Content: chunk,
-				URL:     fmt.Sprintf("calibre://search/_?q=title:%s author:%s", source.Title, source.Attribution),
-				Title:   fmt.Sprintf("%s - %s", source.Title, source.Attribution),
-				Created: createdAt,
-				Tags:    tags,
-				Author:  source.Attribution,
+				Content:    chunk,
+				URL:        fmt.Sprintf("calibre://search/_?q=title:%s author:%s", source.Title, source.Attribution),
+				Title:      fmt.Sprintf("%s - %s", source.Title, source.Attribution),
+				Created:    createdAt,
+				Tags:       tags,
+				Author:     source.Attribution,
+				BookmarkID: entry.BookmarkID,
+				Bookmark:   &entry,
+				Book:       &source,
 			}
 			currentBatch.Highlights = append(currentBatch.Highlights, highlight)
 		}
@@ -0,0 +1,139 @@
+package backend
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestNotado(endpoint string, sleeps *[]time.Duration) *Notado {
+	return &Notado{
+		logger:     slog.New(&discardHandler{}),
+		UserAgent:  "noctober/test",
+		endpoint:   endpoint,
+		maxRetries: 3,
+		sleep: func(d time.Duration) {
+			*sleeps = append(*sleeps, d)
+		},
+	}
+}
+
+func TestSendBookmarks_RetriesTemporaryFailures(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`{"data":{"importNotes":1}}`))
+		}
+	}))
+	defer server.Close()
+	var sleeps []time.Duration
+	n := newTestNotado(server.URL, &sleeps)
+	payloads := []Response{{Highlights: []Highlight{{Content: "a", BookmarkID: "1"}}}}
+	result, err := n.SendBookmarks(payloads, "token")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Sent)
+	assert.Equal(t, -1, result.FirstFailedBatch)
+	assert.Equal(t, 3, result.Batches[0].Attempts)
+	assert.Equal(t, []time.Duration{REQUEST_RETRY_BASE_DELAY, 7 * time.Second}, sleeps)
+}
+
+func TestSendBookmarks_StopsAtFirstFailedBatch(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Write([]byte(`{"data":{"importNotes":2}}`))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errors":[{"message":"Variable \"$notes\" got invalid value at \"notes[0].content\"; Expected non-nullable type"}]}`))
+	}))
+	defer server.Close()
+	var sleeps []time.Duration
+	n := newTestNotado(server.URL, &sleeps)
+	payloads := []Response{
+		{Highlights: []Highlight{{Content: "a", BookmarkID: "1"}, {Content: "b1", BookmarkID: "2"}}},
+		{Highlights: []Highlight{{Content: "b2", BookmarkID: "2"}}},
+		{Highlights: []Highlight{{Content: "c", BookmarkID: "3"}}},
+	}
+	result, err := n.SendBookmarks(payloads, "token")
+	assert.Error(t, err)
+	assert.Equal(t, 2, result.Sent)
+	assert.Equal(t, 1, result.FirstFailedBatch)
+	assert.Equal(t, []BatchResult{
+		{Batch: 0, Count: 2, Attempts: 1, Sent: true},
+		{Batch: 1, Count: 1, Attempts: 1, Error: "notado rejected a highlight from \"\" (\"b2\"): Variable \"$notes\" got invalid value at \"notes[0].content\"; Expected non-nullable type"},
+		{Batch: 2, Count: 1},
+	}, result.Batches)
+	assert.Empty(t, sleeps, "client errors should not be retried")
+	assert.Equal(t, map[string]bool{"1": true}, result.SyncedBookmarkIDs(payloads))
+}
+
+func TestSendBookmarks_GraphQLErrorsAreFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		expected error
+	}{
+		{
+			name:     "unauthenticated",
+			status:   http.StatusOK,
+			body:     `{"data":null,"errors":[{"message":"Invalid token","extensions":{"code":"UNAUTHENTICATED"}}]}`,
+			expected: &NotadoAuthError{StatusCode: 200, Message: "Invalid token"},
+		},
+		{
+			name:     "unauthorised status",
+			status:   http.StatusUnauthorized,
+			body:     ``,
+			expected: &NotadoAuthError{StatusCode: 401},
+		},
+		{
+			name:     "invalid note",
+			status:   http.StatusOK,
+			body:     `{"data":null,"errors":[{"message":"title is too long","path":["importNotes","notes",1]}]}`,
+			expected: &NotadoValidationError{NoteIndex: 1, Title: "Emma", Content: "b", Message: "title is too long"},
+		},
+		{
+			name:     "server error",
+			status:   http.StatusOK,
+			body:     `{"data":null,"errors":[{"message":"database unavailable","extensions":{"code":"INTERNAL_SERVER_ERROR"}}]}`,
+			expected: &NotadoServerError{StatusCode: 200, Message: "database unavailable"},
+		},
+		{
+			name:     "imported nothing",
+			status:   http.StatusOK,
+			body:     `{"data":{"importNotes":false}}`,
+			expected: &NotadoServerError{StatusCode: 200, Message: "notes were not imported"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+			var sleeps []time.Duration
+			n := newTestNotado(server.URL, &sleeps)
+			payloads := []Response{{Highlights: []Highlight{
+				{Content: "a", Title: "Dune", BookmarkID: "1"},
+				{Content: "b", Title: "Emma", BookmarkID: "2"},
+			}}}
+			result, err := n.SendBookmarks(payloads, "token")
+			assert.Equal(t, 0, result.Sent)
+			assert.Equal(t, tc.expected, errors.Unwrap(err))
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Package notadotest provides a fake Notado GraphQL server for exercising the
+// sync pipeline without a network connection or a real Notado account.
+package notadotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// Note is a single highlight as received by the importNotes mutation
+type Note struct {
+	Content string   `json:"content"`
+	URL     string   `json:"url"`
+	Title   string   `json:"title"`
+	Created string   `json:"created,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Author  string   `json:"author,omitempty"`
+}
+
+// Failure describes a response to return instead of importing notes. Either a status code,
+// a list of GraphQL errors or both may be set.
+type Failure struct {
+	StatusCode int
+	RetryAfter string
+	Errors     []GraphQLError
+}
+
+type GraphQLError struct {
+	Message    string            `json:"message"`
+	Path       []interface{}     `json:"path,omitempty"`
+	Extensions map[string]string `json:"extensions,omitempty"`
+}
+
+type Server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	token    string
+	notes    []Note
+	requests int
+	failures []Failure
+}
+
+// NewServer starts a fake Notado server which accepts any token until RequireToken is called.
+// Callers should Close the server when finished.
+func NewServer() *Server {
+	s := &Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Endpoint returns the URL of the fake GraphQL endpoint
+func (s *Server) Endpoint() string {
+	return s.URL + "/graphql"
+}
+
+// RequireToken rejects any request that doesn't present the given access token
+func (s *Server) RequireToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+}
+
+// FailNext queues up failures which are returned, in order, for the next requests received
+func (s *Server) FailNext(failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failures...)
+}
+
+// Notes returns every note that has been successfully imported so far
+func (s *Server) Notes() []Note {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Note{}, s.notes...)
+}
+
+// Requests returns the number of requests received, including failed ones
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	if r.Method != http.MethodPost || r.URL.Path != "/graphql" {
+		http.NotFound(w, r)
+		return
+	}
+	if s.token != "" && r.Header.Get("X-API-TOKEN") != s.token {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"data": nil,
+			"errors": []GraphQLError{{
+				Message:    "Invalid token",
+				Extensions: map[string]string{"code": "UNAUTHENTICATED"},
+			}},
+		})
+		return
+	}
+	if len(s.failures) > 0 {
+		failure := s.failures[0]
+		s.failures = s.failures[1:]
+		if failure.RetryAfter != "" {
+			w.Header().Set("Retry-After", failure.RetryAfter)
+		}
+		status := failure.StatusCode
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if len(failure.Errors) == 0 {
+			w.WriteHeader(status)
+			return
+		}
+		writeJSON(w, status, map[string]interface{}{
+			"data":   nil,
+			"errors": failure.Errors,
+		})
+		return
+	}
+
+	var payload struct {
+		Query     string `json:"query"`
+		Variables struct {
+			Notes []Note `json:"notes"`
+		} `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"errors": []GraphQLError{{
+				Message:    fmt.Sprintf("failed to parse request: %s", err),
+				Extensions: map[string]string{"code": "GRAPHQL_PARSE_FAILED"},
+			}},
+		})
+		return
+	}
+	for i, note := range payload.Variables.Notes {
+		if note.Content == "" {
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"data": nil,
+				"errors": []GraphQLError{{
+					Message:    "content must not be empty",
+					Path:       []interface{}{"importNotes", "notes", i},
+					Extensions: map[string]string{"code": "BAD_USER_INPUT"},
+				}},
+			})
+			return
+		}
+	}
+	s.notes = append(s.notes, payload.Variables.Notes...)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"importNotes": len(payload.Variables.Notes),
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,86 @@
+package backend
+
+// SyncPreview describes everything that a sync would send to Notado without anything
+// actually leaving the machine
+type SyncPreview struct {
+	Books      []BookPreview `json:"books"`
+	NoteCount  int           `json:"note_count"`
+	BatchCount int           `json:"batch_count"`
+}
+
+type BookPreview struct {
+	Title      string             `json:"title"`
+	Author     string             `json:"author"`
+	Highlights []HighlightPreview `json:"highlights"`
+}
+
+type HighlightPreview struct {
+	BookmarkID   string   `json:"bookmark_id"`
+	Batch        int      `json:"batch"`
+	Chapter      string   `json:"chapter"`
+	BookProgress float64  `json:"book_progress"`
+	Chunk        int      `json:"chunk"`
+	ChunkCount   int      `json:"chunk_count"`
+	Content      string   `json:"content"`
+	URL          string   `json:"url"`
+	Created      string   `json:"created"`
+	Tags         []string `json:"tags"`
+}
+
+// BuildPreview groups a batched payload by book, noting which batch each note would be
+// sent in and how a highlight was split up if it was too long to send as a single note
+func BuildPreview(payloads []Response) SyncPreview {
+	preview := SyncPreview{
+		Books: []BookPreview{},
+	}
+	bookIndex := map[string]int{}
+	chunkCounts := map[string]int{}
+	for _, payload := range payloads {
+		for _, highlight := range payload.Highlights {
+			chunkCounts[highlight.BookmarkID]++
+		}
+	}
+	chunksSeen := map[string]int{}
+	for batch, payload := range payloads {
+		if len(payload.Highlights) == 0 {
+			continue
+		}
+		preview.BatchCount++
+		for _, highlight := range payload.Highlights {
+			idx, ok := bookIndex[highlight.Title]
+			if !ok {
+				idx = len(preview.Books)
+				bookIndex[highlight.Title] = idx
+				preview.Books = append(preview.Books, BookPreview{
+					Title:  highlight.Title,
+					Author: highlight.Author,
+				})
+			}
+			chunksSeen[highlight.BookmarkID]++
+			chapter := ""
+			progress := 0.0
+			if highlight.Bookmark != nil {
+				chapter = highlight.Bookmark.ChapterTitle
+				progress = highlight.Bookmark.BookProgress
+			}
+			tags := highlight.Tags
+			if tags == nil {
+				tags = []string{}
+			}
+			preview.Books[idx].Highlights = append(preview.Books[idx].Highlights, HighlightPreview{
+				BookmarkID:   highlight.BookmarkID,
+				Batch:        batch + 1,
+				Chapter:      chapter,
+				BookProgress: progress,
+				Chunk:        chunksSeen[highlight.BookmarkID],
+				ChunkCount:   chunkCounts[highlight.BookmarkID],
+				Content:      highlight.Content,
+				URL:          highlight.URL,
+				Created:      highlight.Created,
+				Tags:         tags,
+			})
+			preview.NoteCount++
+		}
+	}
+	return preview
+}
@@ -0,0 +1,81 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildPreview_GroupsBooksAndChunks(t *testing.T) {
+	payloads := []Response{
+		{Highlights: []Highlight{
+			{Content: "First half", Title: "Dune - Frank Herbert", Author: "Frank Herbert", BookmarkID: "a"},
+			{Content: "Short", Title: "Emma - Jane Austen", Author: "Jane Austen", BookmarkID: "b", Tags: []string{"quote"}, Bookmark: &Bookmark{ChapterTitle: "Chapter I", BookProgress: 2.5}},
+		}},
+		{Highlights: []Highlight{
+			{Content: "Second half", Title: "Dune - Frank Herbert", Author: "Frank Herbert", BookmarkID: "a"},
+		}},
+	}
+	expected := SyncPreview{
+		Books: []BookPreview{
+			{
+				Title:  "Dune - Frank Herbert",
+				Author: "Frank Herbert",
+				Highlights: []HighlightPreview{
+					{BookmarkID: "a", Batch: 1, Chunk: 1, ChunkCount: 2, Content: "First half", Tags: []string{}},
+					{BookmarkID: "a", Batch: 2, Chunk: 2, ChunkCount: 2, Content: "Second half", Tags: []string{}},
+				},
+			},
+			{
+				Title:  "Emma - Jane Austen",
+				Author: "Jane Austen",
+				Highlights: []HighlightPreview{
+					{BookmarkID: "b", Batch: 1, Chapter: "Chapter I", BookProgress: 2.5, Chunk: 1, ChunkCount: 1, Content: "Short", Tags: []string{"quote"}},
+				},
+			},
+		},
+		NoteCount:  3,
+		BatchCount: 2,
+	}
+	actual := BuildPreview(payloads)
+	assert.Equal(t, expected, actual)
+}
+
+func TestBuildPreview_Empty(t *testing.T) {
+	actual := BuildPreview(nil)
+	assert.Equal(t, SyncPreview{Books: []BookPreview{}}, actual)
+}
+
+func TestPreviewNotadoSync_WritesNothing(t *testing.T) {
+	b := setupTestBackend(t, "")
+	assert.NoError(t, Conn.Exec(`INSERT INTO Bookmark (BookmarkID, VolumeID, ContentID, StartContainerPath, StartContainerChildIndex, StartOffset, EndContainerPath, EndContainerChildIndex, EndOffset, Text, Annotation, DateCreated, ChapterProgress, Hidden, DateModified, Type) VALUES
+	('m1', 'file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub', 'file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub!!OEBPS/ch01.xhtml', '', 0, 0, '', 0, 0, '', '', '2023-03-03T21:00:00.000', 0.2, 'false', '2023-03-03T21:00:00Z', 'markup')`).Error)
+	mount := t.TempDir()
+	markups := filepath.Join(mount, ".kobo", "markups")
+	assert.NoError(t, os.MkdirAll(markups, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(markups, "m1.svg"), []byte(testMarkupSVG), 0666))
+	b.SelectedKobo.MntPath = mount
+	b.portable = true
+	data := t.TempDir()
+	t.Chdir(data)
+
+	preview, err := b.PreviewNotadoSync()
+	assert.NoError(t, err)
+	var markup *HighlightPreview
+	for _, book := range preview.Books {
+		for i, highlight := range book.Highlights {
+			if highlight.BookmarkID == "m1" {
+				markup = &book.Highlights[i]
+			}
+		}
+	}
+	if assert.NotNil(t, markup) {
+		// The markup links to where it will be rendered by a real sync
+		assert.Contains(t, markup.Content, "m1.png")
+	}
+	entries, err := os.ReadDir(data)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,277 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	READWISE_HIGHLIGHTS_URL    = "https://readwise.io/api/v2/highlights/"
+	READWISE_REQUEST_BATCH_MAX = 2000
+	READWISE_MAX_TEXT_LEN      = 8191
+	READWISE_MAX_TITLE_LEN     = 511
+	READWISE_MAX_AUTHOR_LEN    = 1024
+	READWISE_MAX_NOTE_LEN      = 8191
+	READWISE_SOURCE_TYPE       = "noctober"
+	READWISE_CATEGORY          = "books"
+	READWISE_LOCATION_TYPE     = "order"
+	// READWISE_LOCATION_SCALE turns a bookmark's position into a whole number without losing
+	// the order of highlights that are close together
+	READWISE_LOCATION_SCALE = 10000
+	READWISE_TOKEN_URL      = "https://readwise.io/access_token"
+)
+
+type Readwise struct {
+	logger    *slog.Logger
+	UserAgent string
+	// The following fall back to sensible defaults when left unset
+	endpoint       string
+	maxRetries     int
+	retryBaseDelay time.Duration
+	client         *http.Client
+	sleep          func(time.Duration)
+}
+
+// ReadwiseHighlight is a single highlight in the shape expected by the Readwise highlights API
+type ReadwiseHighlight struct {
+	Text          string `json:"text"`
+	Title         string `json:"title,omitempty"`
+	Author        string `json:"author,omitempty"`
+	SourceType    string `json:"source_type"`
+	Category      string `json:"category"`
+	Note          string `json:"note,omitempty"`
+	Location      int    `json:"location,omitempty"`
+	LocationType  string `json:"location_type,omitempty"`
+	HighlightedAt string `json:"highlighted_at,omitempty"`
+	// BookmarkID links a highlight back to the bookmark it was built from and is never sent to Readwise
+	BookmarkID string `json:"-"`
+}
+
+// ReadwiseAuthError is returned when Readwise doesn't accept the configured access token
+type ReadwiseAuthError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ReadwiseAuthError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("readwise rejected the access token: %s", e.Message)
+	}
+	return fmt.Sprintf("readwise rejected the access token (status code %d). is your access token correct?", e.StatusCode)
+}
+
+// SetEndpoint replaces READWISE_HIGHLIGHTS_URL, which is mostly useful for pointing syncs at
+// the fake server in readwisetest. An empty endpoint goes back to the real API.
+func (r *Readwise) SetEndpoint(endpoint string) {
+	r.endpoint = endpoint
+}
+
+// BuildReadwiseHighlights maps highlights onto the Readwise highlight format. Highlights are
+// located by their position within the whole book and split up if they exceed Readwise's limits.
+func BuildReadwiseHighlights(highlights []Highlight) []ReadwiseHighlight {
+	books := map[string][]Highlight{}
+	var order []string
+	for _, highlight := range uniqueHighlights(highlights) {
+		key := highlight.Title
+		if highlight.Book != nil && highlight.Book.ContentID != "" {
+			key = highlight.Book.ContentID
+		}
+		if _, ok := books[key]; !ok {
+			order = append(order, key)
+		}
+		books[key] = append(books[key], highlight)
+	}
+	var readwiseHighlights []ReadwiseHighlight
+	for _, key := range order {
+		bookHighlights := books[key]
+		sortByPosition(bookHighlights)
+		for _, highlight := range bookHighlights {
+			title := highlight.Title
+			author := highlight.Author
+			if highlight.Book != nil && highlight.Book.Title != "" {
+				title = highlight.Book.Title
+				author = highlight.Book.Attribution
+			}
+			text := highlight.Content
+			note := ""
+			if highlight.Bookmark != nil {
+				text = NormaliseText(highlight.Bookmark.Text)
+				// Readwise understands .tag annotations natively so they are passed through untouched
+				note = strings.TrimSpace(highlight.Bookmark.Annotation)
+				if text == "" {
+					text = highlight.Content
+				}
+			}
+			for _, chunk := range splitHighlight(text, READWISE_MAX_TEXT_LEN) {
+				readwiseHighlights = append(readwiseHighlights, ReadwiseHighlight{
+					Text:          chunk,
+					Title:         TruncateText(title, READWISE_MAX_TITLE_LEN),
+					Author:        TruncateText(author, READWISE_MAX_AUTHOR_LEN),
+					SourceType:    READWISE_SOURCE_TYPE,
+					Category:      READWISE_CATEGORY,
+					Note:          TruncateText(note, READWISE_MAX_NOTE_LEN),
+					Location:      readwiseLocation(highlight),
+					LocationType:  READWISE_LOCATION_TYPE,
+					HighlightedAt: highlight.Created,
+					BookmarkID:    highlight.BookmarkID,
+				})
+			}
+		}
+	}
+	return readwiseHighlights
+}
+
+// readwiseLocation derives a location from the bookmark's position so that it stays the same
+// from one sync to the next. Highlights whose chapter couldn't be found aren't given one.
+func readwiseLocation(highlight Highlight) int {
+	if highlight.Bookmark == nil || highlight.Bookmark.Position < 0 {
+		return 0
+	}
+	return int(math.Round(highlight.Bookmark.Position*READWISE_LOCATION_SCALE)) + 1
+}
+
+// readwiseBatches splits highlights into requests of at most READWISE_REQUEST_BATCH_MAX. The
+// same split is used when working out which bookmarks made it after a failed sync.
+func readwiseBatches(highlights []ReadwiseHighlight) [][]ReadwiseHighlight {
+	var batches [][]ReadwiseHighlight
+	for start := 0; start < len(highlights); start += READWISE_REQUEST_BATCH_MAX {
+		end := min(start+READWISE_REQUEST_BATCH_MAX, len(highlights))
+		batches = append(batches, highlights[start:end])
+	}
+	return batches
+}
+
+// SendHighlights creates highlights in Readwise, which groups them into books by title and author.
+// Readwise skips highlights it already has so sending one again after a failure is harmless.
+func (r *Readwise) SendHighlights(ctx context.Context, highlights []ReadwiseHighlight, token string) (SendResult, error) {
+	batches := readwiseBatches(highlights)
+	retry := retrier{
+		logger:     r.logger,
+		maxRetries: r.maxRetries,
+		baseDelay:  r.retryBaseDelay,
+		sleep:      r.sleep,
+	}
+	return sendBatches(ctx, retry, "Readwise", batches, func(batch []ReadwiseHighlight) (int, error) {
+		return len(batch), r.sendBatch(ctx, batch, token)
+	})
+}
+
+// sendBatch posts highlights to the REST API as a JSON list, authenticating with the token in
+// the Authorization header. Readwise replies with the books that were touched rather than a
+// count, so a successful status means every highlight in the batch was accepted. Rate limits
+// and server errors are retried after any Retry-After wait up to REQUEST_RETRY_MAX_DELAY.
+func (r *Readwise) sendBatch(ctx context.Context, highlights []ReadwiseHighlight, token string) error {
+	data, err := json.Marshal(struct {
+		Highlights []ReadwiseHighlight `json:"highlights"`
+	}{
+		Highlights: highlights,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal Readwise payload: %+v", err)
+	}
+	client := r.client
+	if client == nil {
+		client = &http.Client{}
+	}
+	endpoint := r.endpoint
+	if endpoint == "" {
+		endpoint = READWISE_HIGHLIGHTS_URL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("failed to construct request: %+v", err)
+	}
+	req.Header.Add("Authorization", "Token "+token)
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("User-Agent", r.UserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &retryableError{err: fmt.Errorf("failed to send request to Readwise: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+		return nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	r.logger.Error("Received a non-200 response from Readwise",
+		slog.Int("status_code", resp.StatusCode),
+		slog.String("response", string(body)),
+	)
+	statusErr := fmt.Errorf("received a non-200 status code from Readwise: code %d", resp.StatusCode)
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return &ReadwiseAuthError{StatusCode: resp.StatusCode}
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return &retryableError{
+			err:        statusErr,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	case resp.StatusCode == http.StatusBadRequest:
+		return fmt.Errorf("readwise rejected the highlights that were sent: %s", strings.TrimSpace(string(body)))
+	}
+	return statusErr
+}
+
+// readwiseDestination sends highlights to Readwise. The token is read from settings on every
+// sync so that a token saved in the GUI applies without restarting.
+type readwiseDestination struct {
+	readwise *Readwise
+	settings *Settings
+}
+
+func init() {
+	RegisterDestination(ReadwiseDestinationName, func(b *Backend) Destination {
+		return &readwiseDestination{readwise: b.Readwise, settings: b.Settings}
+	})
+}
+
+func (d *readwiseDestination) Name() string {
+	return ReadwiseDestinationName
+}
+
+func (d *readwiseDestination) Validate() error {
+	if d.settings.ReadwiseToken == "" {
+		return &MissingTokenError{Destination: ReadwiseDestinationName, Hint: fmt.Sprintf("you can find yours at %s", READWISE_TOKEN_URL)}
+	}
+	return nil
+}
+
+func (d *readwiseDestination) Send(ctx context.Context, highlights []Highlight) SyncResult {
+	readwiseHighlights := BuildReadwiseHighlights(highlights)
+	sendResult, err := d.readwise.SendHighlights(ctx, readwiseHighlights, d.settings.ReadwiseToken)
+	result := SyncResult{
+		Destination:      ReadwiseDestinationName,
+		Sent:             sendResult.Sent,
+		Batches:          sendResult.Batches,
+		FirstFailedBatch: sendResult.FirstFailedBatch,
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.Err = err
+		var batchIDs [][]string
+		for _, batch := range readwiseBatches(readwiseHighlights) {
+			ids := make([]string, 0, len(batch))
+			for _, highlight := range batch {
+				ids = append(ids, highlight.BookmarkID)
+			}
+			batchIDs = append(batchIDs, ids)
+		}
+		for id := range sendResult.syncedBookmarkIDs(batchIDs) {
+			result.Synced = append(result.Synced, id)
+		}
+	}
+	return result
+}
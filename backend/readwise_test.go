@@ -0,0 +1,89 @@
+package backend
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcus-crane/october/backend/readwisetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildReadwiseHighlights_RespectsLimits(t *testing.T) {
+	book := &Content{ContentID: "dune", Title: strings.Repeat("D", 600), Attribution: "Frank Herbert"}
+	long := strings.Repeat("a", READWISE_MAX_TEXT_LEN+10)
+	// The later highlight is near the start of its chapter but that chapter comes second
+	highlights := []Highlight{
+		{Content: "later", BookmarkID: "b", Created: "2023-03-02T21:00:00+00:00", Book: book, Bookmark: &Bookmark{Text: "later", Annotation: "nice .quote", ChapterProgress: 0.05, ChapterIndex: 1, Position: 1.05}},
+		{Content: long[:MaxHighlightLen], BookmarkID: "a", Book: book, Bookmark: &Bookmark{Text: long, ChapterProgress: 0.9, Position: 0.9}},
+		{Content: long[MaxHighlightLen:], BookmarkID: "a", Book: book, Bookmark: &Bookmark{Text: long, ChapterProgress: 0.9, Position: 0.9}},
+	}
+	actual := BuildReadwiseHighlights(highlights)
+	assert.Len(t, actual, 3)
+	assert.Equal(t, READWISE_MAX_TEXT_LEN, len(actual[0].Text))
+	assert.Equal(t, "aaaaaaaaaa", actual[1].Text)
+	assert.Equal(t, 9001, actual[0].Location)
+	assert.Equal(t, 9001, actual[1].Location)
+	assert.Equal(t, ReadwiseHighlight{
+		Text:          "later",
+		Title:         strings.Repeat("D", READWISE_MAX_TITLE_LEN-1) + "…",
+		Author:        "Frank Herbert",
+		SourceType:    READWISE_SOURCE_TYPE,
+		Category:      READWISE_CATEGORY,
+		Note:          "nice .quote",
+		Location:      10501,
+		LocationType:  READWISE_LOCATION_TYPE,
+		HighlightedAt: "2023-03-02T21:00:00+00:00",
+		BookmarkID:    "b",
+	}, actual[2])
+}
+
+func TestReadwiseDestination_Send(t *testing.T) {
+	server := readwisetest.NewServer()
+	defer server.Close()
+	server.RequireToken("secret")
+	server.FailNext(readwisetest.Failure{StatusCode: http.StatusTooManyRequests, RetryAfter: "2"})
+	var sleeps []time.Duration
+	d := &readwiseDestination{
+		readwise: &Readwise{
+			logger:   slog.New(&discardHandler{}),
+			endpoint: server.Endpoint(),
+			sleep:    func(d time.Duration) { sleeps = append(sleeps, d) },
+		},
+		settings: &Settings{ReadwiseToken: "secret"},
+	}
+	assert.NoError(t, d.Validate())
+	book := &Content{ContentID: "emma", Title: "Emma", Attribution: "Jane Austen"}
+	result := d.Send(context.Background(), []Highlight{
+		{Content: "Emma Woodhouse", BookmarkID: "a", Book: book, Bookmark: &Bookmark{Text: "Emma Woodhouse"}},
+	})
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 1, result.Sent)
+	assert.Equal(t, []time.Duration{2 * time.Second}, sleeps)
+	assert.Equal(t, []readwisetest.Highlight{{
+		Text:         "Emma Woodhouse",
+		Title:        "Emma",
+		Author:       "Jane Austen",
+		SourceType:   READWISE_SOURCE_TYPE,
+		Category:     READWISE_CATEGORY,
+		Location:     1,
+		LocationType: READWISE_LOCATION_TYPE,
+	}}, server.Highlights())
+
+	d.settings.ReadwiseToken = "wrong"
+	result = d.Send(context.Background(), []Highlight{{Content: "x", BookmarkID: "b"}})
+	var authErr *ReadwiseAuthError
+	assert.ErrorAs(t, result.Err, &authErr)
+	assert.Empty(t, result.Synced)
+}
+
+func TestReadwiseDestination_MissingToken(t *testing.T) {
+	d := &readwiseDestination{readwise: &Readwise{}, settings: &Settings{}}
+	err := d.Validate()
+	assert.True(t, IsMissingTokenError(err))
+	assert.True(t, IsAuthError(err))
+	assert.Equal(t, "no readwise token was configured. you can find yours at "+READWISE_TOKEN_URL, err.Error())
+}
@@ -0,0 +1,121 @@
+// Package readwisetest provides a fake Readwise highlights API for exercising the
+// sync pipeline without a network connection or a real Readwise account.
+package readwisetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// Highlight is a single highlight as received by the highlights endpoint
+type Highlight struct {
+	Text          string `json:"text"`
+	Title         string `json:"title,omitempty"`
+	Author        string `json:"author,omitempty"`
+	SourceType    string `json:"source_type"`
+	Category      string `json:"category"`
+	Note          string `json:"note,omitempty"`
+	Location      int    `json:"location,omitempty"`
+	LocationType  string `json:"location_type,omitempty"`
+	HighlightedAt string `json:"highlighted_at,omitempty"`
+}
+
+// Failure describes a response to return instead of accepting highlights
+type Failure struct {
+	StatusCode int
+	RetryAfter string
+	Body       string
+}
+
+type Server struct {
+	*httptest.Server
+	mu         sync.Mutex
+	token      string
+	highlights []Highlight
+	requests   int
+	failures   []Failure
+}
+
+// NewServer starts a fake Readwise server which accepts any token until RequireToken is called.
+// Callers should Close the server when finished.
+func NewServer() *Server {
+	s := &Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Endpoint returns the URL of the fake highlights endpoint
+func (s *Server) Endpoint() string {
+	return s.URL + "/api/v2/highlights/"
+}
+
+// RequireToken rejects any request that doesn't present the given access token
+func (s *Server) RequireToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+}
+
+// FailNext queues up failures which are returned, in order, for the next requests received
+func (s *Server) FailNext(failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failures...)
+}
+
+// Highlights returns every highlight that has been successfully created so far
+func (s *Server) Highlights() []Highlight {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Highlight{}, s.highlights...)
+}
+
+// Requests returns the number of requests received, including failed ones
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	if r.Method != http.MethodPost || r.URL.Path != "/api/v2/highlights/" {
+		http.NotFound(w, r)
+		return
+	}
+	if s.token != "" && r.Header.Get("Authorization") != "Token "+s.token {
+		http.Error(w, `{"detail":"Invalid token."}`, http.StatusUnauthorized)
+		return
+	}
+	if len(s.failures) > 0 {
+		failure := s.failures[0]
+		s.failures = s.failures[1:]
+		if failure.RetryAfter != "" {
+			w.Header().Set("Retry-After", failure.RetryAfter)
+		}
+		w.WriteHeader(failure.StatusCode)
+		w.Write([]byte(failure.Body))
+		return
+	}
+	var payload struct {
+		Highlights []Highlight `json:"highlights"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, highlight := range payload.Highlights {
+		if highlight.Text == "" || len([]rune(highlight.Text)) > 8191 || len([]rune(highlight.Title)) > 511 {
+			http.Error(w, `{"highlights":[{"text":["This field is invalid."]}]}`, http.StatusBadRequest)
+			return
+		}
+	}
+	s.highlights = append(s.highlights, payload.Highlights...)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode([]interface{}{})
+}
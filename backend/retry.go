@@ -0,0 +1,214 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	REQUEST_MAX_RETRIES      = 5
+	REQUEST_RETRY_BASE_DELAY = time.Second
+	REQUEST_RETRY_MAX_DELAY  = time.Minute
+)
+
+// retryableError marks failures that are worth trying again, such as rate limiting,
+// server errors and flaky networks, along with how long the server asked us to wait
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// retrier repeats a request for as long as it fails with a retryableError, backing off
+// exponentially between attempts unless the server told us how long to wait
+type retrier struct {
+	logger     *slog.Logger
+	maxRetries int
+	baseDelay  time.Duration
+	// sleep replaces waiting on a timer, allowing tests to run without delays
+	sleep func(time.Duration)
+}
+
+// do returns the number of attempts made along with the result of the final attempt
+func (r retrier) do(ctx context.Context, fn func() (int, error)) (int, int, error) {
+	maxRetries := r.maxRetries
+	if maxRetries <= 0 {
+		maxRetries = REQUEST_MAX_RETRIES
+	}
+	baseDelay := r.baseDelay
+	if baseDelay <= 0 {
+		baseDelay = REQUEST_RETRY_BASE_DELAY
+	}
+	attempt := 0
+	for {
+		attempt++
+		count, err := fn()
+		if err == nil {
+			return attempt, count, nil
+		}
+		var retryable *retryableError
+		if !errors.As(err, &retryable) || attempt > maxRetries {
+			return attempt, 0, err
+		}
+		delay := retryable.retryAfter
+		if delay > REQUEST_RETRY_MAX_DELAY {
+			// Waiting for as long as the server asked could stall a sync for hours so the
+			// batch is left for a later sync to try again instead
+			r.logger.Warn("Giving up on batch as the server asked us to wait too long",
+				slog.String("error", err.Error()),
+				slog.Int("attempt", attempt),
+				slog.Duration("retry_after", delay),
+			)
+			return attempt, 0, err
+		}
+		if delay <= 0 {
+			delay = backoffDelay(baseDelay, attempt)
+		}
+		r.logger.Warn("Retrying batch after a temporary failure",
+			slog.String("error", err.Error()),
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+		)
+		if r.sleep != nil {
+			r.sleep(delay)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return attempt, 0, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoffDelay doubles the base delay for every attempt made so far, capped so that
+// a long outage doesn't leave a sync sleeping for hours
+func backoffDelay(base time.Duration, attempt int) time.Duration {
+	delay := base << (attempt - 1)
+	if delay <= 0 || delay > REQUEST_RETRY_MAX_DELAY {
+		return REQUEST_RETRY_MAX_DELAY
+	}
+	return delay
+}
+
+// parseRetryAfter understands both forms of the Retry-After header, being either a number
+// of seconds or an HTTP date, returning zero if the header is missing or unparseable
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if delay := t.Sub(now); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// sendBatches sends each batch to a destination in turn, retrying temporary failures. Sending
+// stops at the first batch that fails for good and the remaining batches are left for the next
+// sync to resume from. send returns how many highlights the destination accepted.
+func sendBatches[T any](ctx context.Context, r retrier, destination string, batches [][]T, send func([]T) (int, error)) (SendResult, error) {
+	result := SendResult{
+		Batches:          []BatchResult{},
+		FirstFailedBatch: -1,
+	}
+	if len(batches) == 0 {
+		r.logger.Info("No highlights to send to " + destination)
+		return result, nil
+	}
+	var sendErr error
+	for i, batch := range batches {
+		batchResult := BatchResult{
+			Batch: i,
+			Count: len(batch),
+		}
+		if sendErr != nil {
+			result.Batches = append(result.Batches, batchResult)
+			continue
+		}
+		attempts, accepted, err := r.do(ctx, func() (int, error) {
+			return send(batch)
+		})
+		batchResult.Attempts = attempts
+		if err != nil {
+			r.logger.Error("Failed to send batch of highlights to "+destination,
+				slog.String("error", err.Error()),
+				slog.Int("batch", i),
+				slog.Int("batch_count", len(batches)),
+				slog.Int("attempts", attempts),
+			)
+			batchResult.Error = err.Error()
+			result.FirstFailedBatch = i
+			sendErr = err
+			result.Batches = append(result.Batches, batchResult)
+			continue
+		}
+		if accepted != len(batch) {
+			r.logger.Warn(destination+" imported a different number of highlights than were sent",
+				slog.Int("batch", i),
+				slog.Int("highlight_count", len(batch)),
+				slog.Int("imported_count", accepted),
+			)
+		}
+		batchResult.Sent = true
+		result.Sent += accepted
+		result.Batches = append(result.Batches, batchResult)
+		r.logger.Info("Successfully sent batch of highlights to "+destination,
+			slog.Int("batch", i),
+			slog.Int("batch_count", len(batches)),
+			slog.Int("highlight_count", len(batch)),
+		)
+	}
+	if sendErr != nil {
+		return result, fmt.Errorf("sent %d of %d batches to %s before failing: %w", result.FirstFailedBatch, len(batches), destination, sendErr)
+	}
+	r.logger.Info("Successfully sent highlights to "+destination,
+		slog.Int("highlight_count", result.Sent),
+		slog.Int("batch_count", len(batches)),
+	)
+	return result, nil
+}
+
+// syncedBookmarkIDs returns the IDs of every bookmark whose highlights all made it into batches
+// that were successfully sent, where batchIDs holds the bookmark ID of each highlight in every
+// batch in the order they were sent. A long highlight may be split across two batches in which
+// case it only counts as synced if both halves were sent.
+func (r SendResult) syncedBookmarkIDs(batchIDs [][]string) map[string]bool {
+	synced := map[string]bool{}
+	unsynced := map[string]bool{}
+	for batch, ids := range batchIDs {
+		sent := batch < len(r.Batches) && r.Batches[batch].Sent
+		for _, id := range ids {
+			if sent {
+				synced[id] = true
+			} else {
+				unsynced[id] = true
+			}
+		}
+	}
+	for id := range unsynced {
+		delete(synced, id)
+	}
+	return synced
+}
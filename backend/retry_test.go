@@ -0,0 +1,53 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter("Mon, 01 Jan 2024 12:01:30 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Mon, 01 Jan 2024 11:00:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+}
+
+func TestBackoffDelay(t *testing.T) {
+	assert.Equal(t, time.Second, backoffDelay(time.Second, 1))
+	assert.Equal(t, 4*time.Second, backoffDelay(time.Second, 3))
+	assert.Equal(t, REQUEST_RETRY_MAX_DELAY, backoffDelay(time.Second, 40))
+}
+
+func TestRetrier_GivesUpWhenAskedToWaitTooLong(t *testing.T) {
+	var sleeps []time.Duration
+	r := retrier{
+		logger: slog.New(&discardHandler{}),
+		sleep: func(d time.Duration) {
+			sleeps = append(sleeps, d)
+		},
+	}
+	calls := 0
+	attempts, _, err := r.do(context.Background(), func() (int, error) {
+		calls++
+		return 0, &retryableError{err: errors.New("slow down"), retryAfter: 24 * time.Hour}
+	})
+	assert.Error(t, err)
+	assert.True(t, IsNetworkError(err), "the batch should still be retried by a later sync")
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, sleeps)
+}
+
+func TestSendResult_SyncedBookmarkIDs(t *testing.T) {
+	result := SendResult{Batches: []BatchResult{{Batch: 0, Sent: true}, {Batch: 1, Sent: false}}}
+	// b was split across both batches so it isn't synced until its second half makes it
+	synced := result.syncedBookmarkIDs([][]string{{"a", "b"}, {"b", "c"}, {"d"}})
+	assert.Equal(t, map[string]bool{"a": true}, synced)
+}
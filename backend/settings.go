@@ -2,18 +2,48 @@ package backend
 
 import (
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
 )
 
 type Settings struct {
-	path                  string `json:"-"`
-	NotadoToken           string `json:"notado_token"`
-	UploadStoreHighlights bool   `json:"upload_store_highlights"`
+	path                  string   `json:"-"`
+	NotadoToken           string   `json:"notado_token"`
+	UploadStoreHighlights bool     `json:"upload_store_highlights"`
+	NotadoEndpoint        string   `json:"notado_endpoint,omitempty"`
+	Destinations          []string `json:"destinations"`
+	MarkdownVaultPath     string   `json:"markdown_vault_path,omitempty"`
+	ReadwiseToken         string   `json:"readwise_token,omitempty"`
+	BackupBeforeSync      bool     `json:"backup_before_sync"`
+	BackupRetention       int      `json:"backup_retention"`
+	// BookmarkTypes picks which kinds of bookmark are synced and exported
+	BookmarkTypes     []BookmarkType `json:"bookmark_types"`
+	ExportPageMarkers bool           `json:"export_page_markers"`
+	// IncludeHiddenHighlights syncs highlights that were deleted on the device, which Kobo
+	// keeps around but hides
+	IncludeHiddenHighlights bool `json:"include_hidden_highlights"`
+	// HighlightColourTags adds a tag to highlights of each colour when they are sent to Notado
+	HighlightColourTags map[HighlightColour]string `json:"highlight_colour_tags,omitempty"`
+	// ContextLength is how many characters of the surrounding text to include on either side
+	// of a highlight. 0 leaves highlights on their own.
+	ContextLength int `json:"context_length"`
+}
+
+func defaultSettings(path string) *Settings {
+	return &Settings{
+		path:                  path,
+		UploadStoreHighlights: true, // default on as users with only store purchased books are blocked from usage otherwise but give ample warning during setup
+		Destinations:          []string{NotadoDestinationName},
+		BackupRetention:       DEFAULT_BACKUP_RETENTION,
+		BookmarkTypes:         DefaultBookmarkTypes,
+	}
 }
 
 func LoadSettings(portable bool, logger *slog.Logger) (*Settings, error) {
@@ -27,10 +57,7 @@ func LoadSettings(portable bool, logger *slog.Logger) (*Settings, error) {
 	logger.Debug("Located settings path",
 		slog.String("path", settingsPath),
 	)
-	s := &Settings{
-		path:                  settingsPath,
-		UploadStoreHighlights: true, // default on as users with only store purchased books are blocked from usage otherwise but give ample warning during setup
-	}
+	s := defaultSettings(settingsPath)
 	b, err := os.ReadFile(settingsPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -51,15 +78,8 @@ func LoadSettings(portable bool, logger *slog.Logger) (*Settings, error) {
 		logger.Warn("Failed to unmarshal settings file. Attempting to repair as v1.6.0 and earlier had known issues.")
 		// v1.6.0 and prior may have caused settings files to have an extra `}` so we check for common issues
 		// We're not gonna go overboard here though, just basic text checking
-		plainSettings := strings.TrimSpace(string(b))
-		if strings.HasPrefix(plainSettings, "{{") {
-			logger.Debug("Stripped duplicate opening braces from corrupted settings file")
-			plainSettings = strings.Replace(plainSettings, "{{", "{", 1)
-		}
-		if strings.HasSuffix(plainSettings, "}}") {
-			logger.Debug("Stripped duplicate closing braces from corrupted settings file")
-			plainSettings = strings.Replace(plainSettings, "}}", "}", 1)
-		}
+		plainSettings := repairSettings(string(b))
+		logger.Debug("Stripped duplicate braces from corrupted settings file")
 		err := json.Unmarshal([]byte(plainSettings), s)
 		if err != nil {
 			logger.Error("Failed to parse settings file after trying brace stripping hack. Can't continue.",
@@ -87,6 +107,18 @@ func LoadSettings(portable bool, logger *slog.Logger) (*Settings, error) {
 	return s, nil
 }
 
+// repairSettings strips the duplicate braces that v1.6.0 and prior could leave in settings files
+func repairSettings(plainSettings string) string {
+	plainSettings = strings.TrimSpace(plainSettings)
+	if strings.HasPrefix(plainSettings, "{{") {
+		plainSettings = strings.Replace(plainSettings, "{{", "{", 1)
+	}
+	if strings.HasSuffix(plainSettings, "}}") {
+		plainSettings = strings.Replace(plainSettings, "}}", "}", 1)
+	}
+	return plainSettings
+}
+
 func (s *Settings) Save() error {
 	b, err := json.MarshalIndent(s, "", "\t")
 	if err != nil {
@@ -112,3 +144,224 @@ func (s *Settings) SaveStoreHighlights(uploadStoreHighlights bool) error {
 	s.UploadStoreHighlights = uploadStoreHighlights
 	return s.Save()
 }
+
+func (s *Settings) SaveNotadoEndpoint(endpoint string) error {
+	s.NotadoEndpoint = endpoint
+	return s.Save()
+}
+
+func (s *Settings) SaveDestinations(destinations []string) error {
+	for _, name := range destinations {
+		if _, ok := destinationFactories[name]; !ok {
+			return fmt.Errorf("unknown destination %q. available destinations are %v", name, AvailableDestinations())
+		}
+	}
+	s.Destinations = destinations
+	return s.Save()
+}
+
+func (s *Settings) SaveMarkdownVaultPath(path string) error {
+	s.MarkdownVaultPath = path
+	return s.Save()
+}
+
+func (s *Settings) SaveReadwiseToken(token string) error {
+	s.ReadwiseToken = token
+	return s.Save()
+}
+
+func (s *Settings) SaveBackupBeforeSync(backupBeforeSync bool) error {
+	s.BackupBeforeSync = backupBeforeSync
+	return s.Save()
+}
+
+func (s *Settings) SaveBackupRetention(retention int) error {
+	s.BackupRetention = retention
+	return s.Save()
+}
+
+func (s *Settings) SaveBookmarkTypes(types []BookmarkType) error {
+	if len(types) == 0 {
+		// Nothing at all would be synced so every sync would fail with no highlights
+		return fmt.Errorf("at least one bookmark type must be synced. available types are %v", []BookmarkType{BookmarkTypeHighlight, BookmarkTypeNote, BookmarkTypeMarkup})
+	}
+	for _, t := range types {
+		if t == BookmarkTypeDogear {
+			return fmt.Errorf("dogears have no text to sync. turn on export page markers to include them in exports instead")
+		}
+		if !slices.Contains(AllBookmarkTypes, t) {
+			return fmt.Errorf("unknown bookmark type %q. available types are %v", t, []BookmarkType{BookmarkTypeHighlight, BookmarkTypeNote, BookmarkTypeMarkup})
+		}
+	}
+	s.BookmarkTypes = types
+	return s.Save()
+}
+
+func (s *Settings) SaveExportPageMarkers(exportPageMarkers bool) error {
+	s.ExportPageMarkers = exportPageMarkers
+	return s.Save()
+}
+
+func (s *Settings) SaveIncludeHiddenHighlights(includeHidden bool) error {
+	s.IncludeHiddenHighlights = includeHidden
+	return s.Save()
+}
+
+func (s *Settings) SaveHighlightColourTags(tags map[HighlightColour]string) error {
+	cleaned := map[HighlightColour]string{}
+	for colour, tag := range tags {
+		if !slices.Contains(HighlightColours, colour) {
+			return fmt.Errorf("unknown highlight colour %q. available colours are %v", colour, HighlightColours)
+		}
+		// Tags are written as .tag in annotations so a leading dot is dropped for consistency
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), ".")
+		if strings.ContainsAny(tag, " \t") {
+			return fmt.Errorf("the tag for %s highlights can't contain spaces but got %q", colour, tag)
+		}
+		if tag != "" {
+			cleaned[colour] = tag
+		}
+	}
+	s.HighlightColourTags = cleaned
+	return s.Save()
+}
+
+func (s *Settings) SaveContextLength(length int) error {
+	if length < 0 || length > MaxContextLength {
+		return fmt.Errorf("context length must be between 0 and %d characters but got %d", MaxContextLength, length)
+	}
+	s.ContextLength = length
+	return s.Save()
+}
+
+// colourTag returns the tag for highlights of the given colour, if one was picked
+func (s *Settings) colourTag(colour HighlightColour) string {
+	if s == nil || colour == "" {
+		return ""
+	}
+	return s.HighlightColourTags[colour]
+}
+
+// bookmarkTypes falls back to the defaults for settings that were never given any types
+func (s *Settings) bookmarkTypes() []BookmarkType {
+	if s == nil || s.BookmarkTypes == nil {
+		return DefaultBookmarkTypes
+	}
+	return s.BookmarkTypes
+}
+
+// Path returns the location of the settings file on disc
+func (s *Settings) Path() string {
+	return s.path
+}
+
+// Redacted returns a copy of the settings which is safe to print, with access tokens masked
+func (s *Settings) Redacted() Settings {
+	redacted := *s
+	redacted.NotadoToken = redactToken(s.NotadoToken)
+	redacted.ReadwiseToken = redactToken(s.ReadwiseToken)
+	return redacted
+}
+
+// SettingOptions lists the names accepted by SetOption
+var SettingOptions = []string{
+	"upload-store-highlights",
+	"notado-endpoint",
+	"destinations",
+	"markdown-vault-path",
+	"backup-before-sync",
+	"backup-retention",
+	"bookmark-types",
+	"export-page-markers",
+	"include-hidden-highlights",
+	"highlight-colour-tags",
+	"context-length",
+}
+
+// SetOption updates a single setting by name from its text form, so that settings can be
+// changed without the gui. Access tokens are deliberately not settable this way.
+func (s *Settings) SetOption(name string, value string) error {
+	switch name {
+	case "upload-store-highlights":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false but got %q", name, value)
+		}
+		return s.SaveStoreHighlights(enabled)
+	case "notado-endpoint":
+		return s.SaveNotadoEndpoint(value)
+	case "destinations":
+		destinations := []string{}
+		for _, destination := range strings.Split(value, ",") {
+			if destination = strings.TrimSpace(destination); destination != "" {
+				destinations = append(destinations, destination)
+			}
+		}
+		return s.SaveDestinations(destinations)
+	case "markdown-vault-path":
+		return s.SaveMarkdownVaultPath(value)
+	case "backup-before-sync":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false but got %q", name, value)
+		}
+		return s.SaveBackupBeforeSync(enabled)
+	case "backup-retention":
+		retention, err := strconv.Atoi(value)
+		if err != nil || retention < 0 {
+			return fmt.Errorf("%s must be a number of backups to keep per device, or 0 to keep them all, but got %q", name, value)
+		}
+		return s.SaveBackupRetention(retention)
+	case "bookmark-types":
+		types := []BookmarkType{}
+		for _, t := range strings.Split(value, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, BookmarkType(t))
+			}
+		}
+		return s.SaveBookmarkTypes(types)
+	case "export-page-markers":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false but got %q", name, value)
+		}
+		return s.SaveExportPageMarkers(enabled)
+	case "include-hidden-highlights":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false but got %q", name, value)
+		}
+		return s.SaveIncludeHiddenHighlights(enabled)
+	case "highlight-colour-tags":
+		tags := map[HighlightColour]string{}
+		for _, pair := range strings.Split(value, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			colour, tag, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("%s must be a list of colour=tag pairs such as yellow=quote,blue=vocab but got %q", name, value)
+			}
+			tags[HighlightColour(strings.ToLower(strings.TrimSpace(colour)))] = tag
+		}
+		return s.SaveHighlightColourTags(tags)
+	case "context-length":
+		length, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a number of characters to include either side of a highlight, or 0 for none, but got %q", name, value)
+		}
+		return s.SaveContextLength(length)
+	}
+	return fmt.Errorf("unknown setting %q. available settings are %v", name, SettingOptions)
+}
+
+// redactToken keeps just enough of a token for someone to tell which one is configured
+func redactToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	if len(token) <= 8 {
+		return "********"
+	}
+	return "********" + token[len(token)-4:]
+}
@@ -0,0 +1,51 @@
+package backend
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettings_Redacted(t *testing.T) {
+	s := &Settings{NotadoToken: "abcdefghijklmnop", ReadwiseToken: "short"}
+	redacted := s.Redacted()
+	assert.Equal(t, "********mnop", redacted.NotadoToken)
+	assert.Equal(t, "********", redacted.ReadwiseToken)
+	assert.Equal(t, "abcdefghijklmnop", s.NotadoToken)
+	assert.Equal(t, "", (&Settings{}).Redacted().NotadoToken)
+}
+
+func TestSettings_SetOption(t *testing.T) {
+	s := &Settings{path: filepath.Join(t.TempDir(), "config.json"), UploadStoreHighlights: true}
+
+	assert.NoError(t, s.SetOption("upload-store-highlights", "false"))
+	assert.NoError(t, s.SetOption("destinations", "notado, markdown"))
+	assert.ErrorContains(t, s.SetOption("upload-store-highlights", "sometimes"), "must be true or false")
+	assert.ErrorContains(t, s.SetOption("destinations", "notado,nowhere"), `unknown destination "nowhere"`)
+	assert.ErrorContains(t, s.SetOption("notado-token", "secret"), `unknown setting "notado-token"`)
+	assert.NoError(t, s.SetOption("bookmark-types", "highlight,markup"))
+	assert.ErrorContains(t, s.SetOption("bookmark-types", "dogear"), "export page markers")
+	assert.ErrorContains(t, s.SetOption("bookmark-types", "scribble"), `unknown bookmark type "scribble"`)
+	assert.ErrorContains(t, s.SetOption("bookmark-types", " , "), "at least one bookmark type")
+	assert.ErrorContains(t, s.SaveBookmarkTypes([]BookmarkType{}), "at least one bookmark type")
+	assert.NoError(t, s.SetOption("highlight-colour-tags", "Yellow=.quote, blue=vocab, green="))
+	assert.ErrorContains(t, s.SetOption("highlight-colour-tags", "purple=royal"), `unknown highlight colour "purple"`)
+	assert.ErrorContains(t, s.SetOption("highlight-colour-tags", "blue"), "colour=tag pairs")
+	assert.ErrorContains(t, s.SetOption("highlight-colour-tags", "blue=two words"), "can't contain spaces")
+	assert.NoError(t, s.SetOption("context-length", "200"))
+	assert.ErrorContains(t, s.SetOption("context-length", "a sentence"), "number of characters")
+	assert.ErrorContains(t, s.SetOption("context-length", "5000"), "between 0 and 1000")
+
+	b, err := os.ReadFile(s.Path())
+	assert.NoError(t, err)
+	var saved Settings
+	assert.NoError(t, json.Unmarshal(b, &saved))
+	assert.False(t, saved.UploadStoreHighlights)
+	assert.Equal(t, []string{NotadoDestinationName, MarkdownDestinationName}, saved.Destinations)
+	assert.Equal(t, []BookmarkType{BookmarkTypeHighlight, BookmarkTypeMarkup}, saved.BookmarkTypes)
+	assert.Equal(t, map[HighlightColour]string{HighlightColourYellow: "quote", HighlightColourBlue: "vocab"}, saved.HighlightColourTags)
+	assert.Equal(t, 200, saved.ContextLength)
+}
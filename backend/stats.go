@@ -0,0 +1,147 @@
+package backend
+
+import (
+	"log/slog"
+	"sort"
+	"strconv"
+)
+
+// Kobo's ReadStatus values for a book
+const (
+	readStatusUnread   = 0
+	readStatusReading  = 1
+	readStatusFinished = 2
+)
+
+// ReadingStats summarises the reading history that Kobo keeps for each book. Times are in seconds.
+type ReadingStats struct {
+	TotalReadingTime  int              `json:"total_reading_time"`
+	AverageSession    int              `json:"average_session"`
+	BooksFinished     int              `json:"books_finished"`
+	FinishedByYear    []PeriodCount    `json:"finished_by_year"`
+	FinishedByMonth   []PeriodCount    `json:"finished_by_month"`
+	CurrentlyReading  []BookProgress   `json:"currently_reading"`
+	HighlightsPerBook []BookHighlights `json:"highlights_per_book"`
+}
+
+// PeriodCount is how many books were finished in a year (2006) or month (2006-01)
+type PeriodCount struct {
+	Period string `json:"period"`
+	Books  int    `json:"books"`
+}
+
+type BookProgress struct {
+	Title       string `json:"title"`
+	Author      string `json:"author"`
+	PercentRead int    `json:"percent_read"`
+	TimeSpent   int    `json:"time_spent"`
+	LastRead    string `json:"last_read"`
+}
+
+type BookHighlights struct {
+	Title      string `json:"title"`
+	Author     string `json:"author"`
+	Highlights int    `json:"highlights"`
+}
+
+// GetReadingStats reports on every book on the device, including store bought books regardless
+// of whether their highlights are synced, since reading time is tracked the same way for both
+func (b *Backend) GetReadingStats() (ReadingStats, error) {
+	content, err := b.Kobo.ListDeviceContent(true, b.logger)
+	if err != nil {
+		slog.Error("Received an error trying to list content from device",
+			slog.String("error", err.Error()),
+		)
+		return ReadingStats{}, err
+	}
+	// Dogears only mark a page so they aren't counted as highlights
+	bookmarks, err := b.Kobo.ListDeviceBookmarks(true, false, []BookmarkType{BookmarkTypeHighlight, BookmarkTypeNote, BookmarkTypeMarkup}, b.logger)
+	if err != nil {
+		slog.Error("Received an error trying to list bookmarks from device",
+			slog.String("error", err.Error()),
+		)
+		return ReadingStats{}, err
+	}
+	stats := BuildReadingStats(content, bookmarks)
+	slog.Info("Built reading stats",
+		slog.Int("book_count", len(content)),
+		slog.Int("books_finished", stats.BooksFinished),
+	)
+	return stats, nil
+}
+
+func BuildReadingStats(content []Content, bookmarks []Bookmark) ReadingStats {
+	stats := ReadingStats{
+		FinishedByYear:    []PeriodCount{},
+		FinishedByMonth:   []PeriodCount{},
+		CurrentlyReading:  []BookProgress{},
+		HighlightsPerBook: []BookHighlights{},
+	}
+	sessions := 0
+	years := map[string]int{}
+	months := map[string]int{}
+	for _, book := range content {
+		stats.TotalReadingTime += book.TimeSpentReading
+		sessions += book.TimesStartedReading
+		switch book.ReadStatus {
+		case readStatusFinished:
+			stats.BooksFinished++
+			finished, ok := parseKoboTimestamp(book.LastTimeFinishedReading)
+			if !ok {
+				finished, ok = parseKoboTimestamp(book.DateLastRead)
+			}
+			if ok {
+				years[finished.Format("2006")]++
+				months[finished.Format("2006-01")]++
+			}
+		case readStatusReading:
+			percent, _ := strconv.Atoi(book.PercentRead)
+			stats.CurrentlyReading = append(stats.CurrentlyReading, BookProgress{
+				Title:       book.Title,
+				Author:      book.Attribution,
+				PercentRead: percent,
+				TimeSpent:   book.TimeSpentReading,
+				LastRead:    normaliseTimestamp(book.DateLastRead),
+			})
+		}
+	}
+	if sessions > 0 {
+		stats.AverageSession = stats.TotalReadingTime / sessions
+	}
+	stats.FinishedByYear = periodCounts(years)
+	stats.FinishedByMonth = periodCounts(months)
+	sort.SliceStable(stats.CurrentlyReading, func(i, j int) bool {
+		return stats.CurrentlyReading[i].LastRead > stats.CurrentlyReading[j].LastRead
+	})
+
+	counts := map[string]int{}
+	for _, bookmark := range bookmarks {
+		counts[bookmark.VolumeID]++
+	}
+	for _, book := range content {
+		if counts[book.ContentID] == 0 {
+			continue
+		}
+		stats.HighlightsPerBook = append(stats.HighlightsPerBook, BookHighlights{
+			Title:      book.Title,
+			Author:     book.Attribution,
+			Highlights: counts[book.ContentID],
+		})
+	}
+	sort.SliceStable(stats.HighlightsPerBook, func(i, j int) bool {
+		return stats.HighlightsPerBook[i].Highlights > stats.HighlightsPerBook[j].Highlights
+	})
+	return stats
+}
+
+// periodCounts orders periods oldest first
+func periodCounts(counts map[string]int) []PeriodCount {
+	periods := []PeriodCount{}
+	for period, books := range counts {
+		periods = append(periods, PeriodCount{Period: period, Books: books})
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i].Period < periods[j].Period
+	})
+	return periods
+}
@@ -0,0 +1,40 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetReadingStats(t *testing.T) {
+	b := setupTestBackend(t, "")
+
+	stats, err := b.GetReadingStats()
+	assert.NoError(t, err)
+	assert.Equal(t, ReadingStats{
+		TotalReadingTime: 48600,
+		AverageSession:   4418,
+		BooksFinished:    2,
+		FinishedByYear:   []PeriodCount{{Period: "2023", Books: 2}},
+		FinishedByMonth: []PeriodCount{
+			{Period: "2023-01", Books: 1},
+			{Period: "2023-03", Books: 1},
+		},
+		CurrentlyReading: []BookProgress{
+			{Title: "Emma", Author: "Jane Austen", PercentRead: 42, TimeSpent: 7200, LastRead: "2023-04-10T08:00:00Z"},
+		},
+		// The dogear in Dune isn't a highlight so it isn't counted
+		HighlightsPerBook: []BookHighlights{
+			{Title: "Dune", Author: "Frank Herbert", Highlights: 2},
+			{Title: "Meditations", Author: "Marcus Aurelius", Highlights: 1},
+			{Title: "Emma", Author: "Jane Austen", Highlights: 1},
+		},
+	}, stats)
+}
+
+func TestBuildReadingStats_NoHistory(t *testing.T) {
+	stats := BuildReadingStats([]Content{{Title: "Unread", ReadStatus: readStatusUnread}}, nil)
+	assert.Equal(t, 0, stats.AverageSession)
+	assert.Empty(t, stats.FinishedByYear)
+	assert.NotNil(t, stats.CurrentlyReading)
+}
@@ -0,0 +1,329 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// ForwardToNotado sends any highlights that haven't been synced yet to Notado alone,
+// regardless of which other destinations are enabled
+func (b *Backend) ForwardToNotado() (int, error) {
+	destination := destinationFactories[NotadoDestinationName](b)
+	results, err := b.syncDestinations(b.context(), []Destination{destination})
+	if len(results) == 0 {
+		return 0, err
+	}
+	return results[0].Sent, err
+}
+
+// SyncHighlights sends any highlights that haven't been synced yet to every destination
+// enabled in settings. A destination failing doesn't stop the others from being synced.
+func (b *Backend) SyncHighlights() ([]SyncResult, error) {
+	destinations, err := b.enabledDestinations()
+	if err != nil {
+		slog.Error("Failed to determine which destinations to sync to",
+			slog.String("error", err.Error()),
+		)
+		return nil, err
+	}
+	return b.syncDestinations(b.context(), destinations)
+}
+
+// SyncHighlightsTo behaves like SyncHighlights but sends to the named destinations
+// instead of the ones enabled in settings, such as when picking destinations for a single run
+func (b *Backend) SyncHighlightsTo(names []string) ([]SyncResult, error) {
+	destinations, err := b.namedDestinations(names)
+	if err != nil {
+		slog.Error("Failed to determine which destinations to sync to",
+			slog.String("error", err.Error()),
+		)
+		return nil, err
+	}
+	return b.syncDestinations(b.context(), destinations)
+}
+
+// PreviewNotadoSync builds exactly the same payload that ForwardToNotado would send
+// but returns it for inspection instead of contacting Notado
+func (b *Backend) PreviewNotadoSync() (SyncPreview, error) {
+	bookmarks, contentIndex, err := b.collectBookmarks()
+	if err != nil {
+		return SyncPreview{}, err
+	}
+	pending := b.SyncState.FilterUnsynced(NotadoDestinationName, bookmarks)
+	// A dry run mustn't write anything so markups are linked to where they would be rendered
+	b.previewMarkups(pending)
+	b.resolveContext(pending)
+	payload, err := b.buildPayload(pending, contentIndex)
+	if err != nil {
+		slog.Error("Received an error trying to build Notado payload",
+			slog.String("error", err.Error()),
+		)
+		return SyncPreview{}, err
+	}
+	preview := BuildPreview(payload)
+	slog.Info("Built preview of Notado sync",
+		slog.Int("book_count", len(preview.Books)),
+		slog.Int("note_count", preview.NoteCount),
+		slog.Int("batch_count", preview.BatchCount),
+	)
+	return preview, nil
+}
+
+func (b *Backend) ResetSyncState() error {
+	b.logger.Info("Resetting sync state. All highlights will be sent on the next sync.")
+	if err := b.SyncState.Reset(); err != nil {
+		b.logger.Error("Failed to reset sync state",
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+	return nil
+}
+
+// context returns the context that syncs should run under, which is the Wails runtime context
+// for the GUI or whatever context the CLI started the backend with
+func (b *Backend) context() context.Context {
+	if b.RuntimeContext == nil || *b.RuntimeContext == nil {
+		return context.Background()
+	}
+	return *b.RuntimeContext
+}
+
+// syncDestinations reads highlights from the selected device once and sends each destination
+// whichever of them it hasn't seen before, recording what made it in the sync state
+func (b *Backend) syncDestinations(ctx context.Context, destinations []Destination) ([]SyncResult, error) {
+	if b.Settings.BackupBeforeSync {
+		if _, err := b.BackupKobo(); err != nil {
+			return nil, fmt.Errorf("failed to back up kobo before syncing so nothing was synced: %w", err)
+		}
+	}
+	bookmarks, contentIndex, err := b.collectBookmarks()
+	if err != nil {
+		return nil, err
+	}
+	var results []SyncResult
+	var errs []error
+	for _, destination := range destinations {
+		result := b.syncDestination(ctx, destination, bookmarks, contentIndex)
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", destination.Name(), result.Err))
+		}
+		results = append(results, result)
+	}
+	b.reportOrphans(results)
+	if err := b.SyncState.Save(); err != nil {
+		// The highlights made it to their destinations so we don't want to report failure here
+		// but the next sync will end up sending these highlights again
+		slog.Error("Failed to persist sync state",
+			slog.String("error", err.Error()),
+		)
+	}
+	return results, errors.Join(errs...)
+}
+
+func (b *Backend) syncDestination(ctx context.Context, destination Destination, bookmarks []Bookmark, contentIndex map[string]Content) SyncResult {
+	name := destination.Name()
+	if err := destination.Validate(); err != nil {
+		slog.Error("Destination is not configured correctly so skipping it",
+			slog.String("destination", name),
+			slog.String("error", err.Error()),
+		)
+		return failedSyncResult(name, err)
+	}
+	pending := b.SyncState.FilterUnsynced(name, bookmarks)
+	slog.Info("Filtered out previously synced bookmarks",
+		slog.String("destination", name),
+		slog.Int("bookmark_count", len(bookmarks)),
+		slog.Int("pending_count", len(pending)),
+	)
+	if len(pending) == 0 {
+		slog.Info("All highlights have already been synced so there is nothing new to send",
+			slog.String("destination", name),
+		)
+		return SyncResult{Destination: name, FirstFailedBatch: -1}
+	}
+	if wholeBook, ok := destination.(WholeBookDestination); ok && wholeBook.SendsWholeBooks() {
+		pending = expandToWholeBooks(pending, bookmarks)
+	}
+	// Markups are only rendered and context read from books once they're about to be sent
+	// since both mean reading files from the device
+	b.extractMarkups(pending)
+	b.resolveContext(pending)
+	payload, err := b.buildPayload(pending, contentIndex)
+	if err != nil {
+		slog.Error("Received an error trying to build payload",
+			slog.String("destination", name),
+			slog.String("error", err.Error()),
+		)
+		return failedSyncResult(name, err)
+	}
+	var highlights []Highlight
+	for _, batch := range payload {
+		highlights = append(highlights, batch.Highlights...)
+	}
+	result := destination.Send(ctx, highlights)
+	if result.Err != nil {
+		slog.Error("Received an error trying to send highlights",
+			slog.String("destination", name),
+			slog.String("error", result.Err.Error()),
+			slog.Int("payload_count", result.Sent),
+			slog.Int("first_failed_batch", result.FirstFailedBatch),
+		)
+	} else {
+		slog.Info("Successfully sent highlights",
+			slog.String("destination", name),
+			slog.Int("payload_count", result.Sent),
+		)
+	}
+	// Whatever made it to the destination is recorded, even after a partial failure, so that
+	// the next sync resumes from the first batch that didn't make it
+	synced := pending
+	if result.Err != nil {
+		syncedIDs := map[string]bool{}
+		for _, id := range result.Synced {
+			syncedIDs[id] = true
+		}
+		synced = nil
+		for _, bookmark := range pending {
+			if syncedIDs[bookmark.BookmarkID] {
+				synced = append(synced, bookmark)
+			}
+		}
+	}
+	b.SyncState.Record(name, synced, b.SelectedKobo.identifier())
+	result.Books = bookResults(pending, synced, contentIndex)
+	return result
+}
+
+// ListOrphanedHighlights returns highlights synced from the selected device that have since
+// been deleted or hidden on it, so that they can be cleaned up at their destinations
+func (b *Backend) ListOrphanedHighlights() ([]OrphanedHighlight, error) {
+	hidden, err := b.Kobo.bookmarkVisibility(b.logger)
+	if err != nil {
+		return nil, err
+	}
+	return b.SyncState.Orphaned(b.SelectedKobo.identifier(), hidden, b.Settings.IncludeHiddenHighlights), nil
+}
+
+// ForgetOrphanedHighlights stops reporting the selected device's orphaned highlights, for once
+// they have been cleaned up
+func (b *Backend) ForgetOrphanedHighlights() ([]OrphanedHighlight, error) {
+	orphans, err := b.ListOrphanedHighlights()
+	if err != nil {
+		return nil, err
+	}
+	b.SyncState.Forget(orphans)
+	if err := b.SyncState.Save(); err != nil {
+		slog.Error("Failed to persist sync state",
+			slog.String("error", err.Error()),
+		)
+		return nil, err
+	}
+	slog.Info("Forgot orphaned highlights",
+		slog.Int("count", len(orphans)),
+	)
+	return orphans, nil
+}
+
+// reportOrphans attaches any orphaned highlights to the result for their destination. Failing
+// to check isn't worth failing a sync over so it is only logged.
+func (b *Backend) reportOrphans(results []SyncResult) {
+	orphans, err := b.ListOrphanedHighlights()
+	if err != nil {
+		slog.Error("Failed to check for highlights that were deleted since they were synced",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	for i := range results {
+		for _, orphan := range orphans {
+			if orphan.Destination == results[i].Destination {
+				results[i].Orphaned = append(results[i].Orphaned, orphan)
+			}
+		}
+		if len(results[i].Orphaned) > 0 {
+			slog.Warn("Highlights that were synced before have been deleted or hidden on the device",
+				slog.String("destination", results[i].Destination),
+				slog.Int("count", len(results[i].Orphaned)),
+			)
+		}
+	}
+}
+
+// collectBookmarks reads every highlight from the selected device along with an index
+// of the books that they belong to
+func (b *Backend) collectBookmarks() ([]Bookmark, map[string]Content, error) {
+	types := b.Settings.bookmarkTypes()
+	includeHidden := b.Settings.IncludeHiddenHighlights
+	highlightBreakdown := b.Kobo.CountDeviceBookmarks(Conn, includeHidden, types, b.logger)
+	slog.Info("Got highlight counts from device",
+		slog.Int("highlight_count_sideload", int(highlightBreakdown.Sideloaded)),
+		slog.Int("highlight_count_official", int(highlightBreakdown.Official)),
+		slog.Int("highlight_count_total", int(highlightBreakdown.Total)),
+	)
+	if highlightBreakdown.Total == 0 {
+		slog.Error("Tried to submit highlights when there are none on device.")
+		return nil, nil, &NoHighlightsError{Message: "Your device doesn't seem to have any highlights so there is nothing left to sync."}
+	}
+	includeStoreBought := b.Settings.UploadStoreHighlights
+	if !includeStoreBought && highlightBreakdown.Sideloaded == 0 {
+		slog.Error("Tried to submit highlights with no sideloaded highlights + store-bought syncing disabled. Result is that no highlights would be fetched.")
+		return nil, nil, &NoHighlightsError{Message: "You have disabled store-bought syncing but you don't have any sideloaded highlights either. This combination means there are no highlights left to be synced."}
+	}
+	content, err := b.Kobo.ListDeviceContent(includeStoreBought, b.logger)
+	if err != nil {
+		slog.Error("Received an error trying to list content from device",
+			slog.String("error", err.Error()),
+		)
+		return nil, nil, err
+	}
+	contentIndex := b.Kobo.BuildContentIndex(content, b.logger)
+	bookmarks, err := b.Kobo.ListDeviceBookmarks(includeStoreBought, includeHidden, types, b.logger)
+	if err != nil {
+		slog.Error("Received an error trying to list bookmarks from device",
+			slog.String("error", err.Error()),
+		)
+		return nil, nil, err
+	}
+	if err := b.resolveChapters(bookmarks); err != nil {
+		return nil, nil, err
+	}
+	return bookmarks, contentIndex, nil
+}
+
+// buildPayload builds the payload for bookmarks and then tags each highlight by its colour
+// according to the user's settings
+func (b *Backend) buildPayload(bookmarks []Bookmark, contentIndex map[string]Content) ([]Response, error) {
+	payload, err := BuildPayload(bookmarks, contentIndex, b.logger)
+	if err != nil {
+		return nil, err
+	}
+	for _, batch := range payload {
+		for i, highlight := range batch.Highlights {
+			if highlight.Bookmark == nil {
+				continue
+			}
+			tag := b.Settings.colourTag(highlight.Bookmark.Colour)
+			if tag != "" && !slices.Contains(highlight.Tags, tag) {
+				batch.Highlights[i].Tags = append(highlight.Tags, tag)
+			}
+		}
+	}
+	return payload, nil
+}
+
+// resolveChapters looks up the chapter that each bookmark was made in
+func (b *Backend) resolveChapters(bookmarks []Bookmark) error {
+	chapters, err := b.Kobo.ListDeviceChapters(b.logger)
+	if err != nil {
+		slog.Error("Received an error trying to list chapters from device",
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+	assignChapters(bookmarks, b.Kobo.BuildChapterIndex(chapters, b.logger), chapterSpans(chapters))
+	return nil
+}
@@ -0,0 +1,234 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SyncState is a local ledger of every bookmark that has been successfully sent to each
+// destination along with a hash of its contents so that subsequent syncs only need to send
+// highlights that are either brand new or have been edited on the device since.
+type SyncState struct {
+	path         string                          `json:"-"`
+	Destinations map[string]map[string]SyncEntry `json:"destinations"`
+	// Entries is only read from sync state files written before destinations were
+	// introduced, at which point Notado was the only place highlights could be sent
+	Entries map[string]SyncEntry `json:"entries,omitempty"`
+}
+
+type SyncEntry struct {
+	Hash     string `json:"hash"`
+	Device   string `json:"device"`
+	SyncedAt string `json:"synced_at"`
+	// VolumeID and Text are kept so that a highlight can still be described after it has been
+	// deleted from the device. Entries written by older versions don't have them.
+	VolumeID string `json:"volume_id,omitempty"`
+	Text     string `json:"text,omitempty"`
+}
+
+const (
+	OrphanDeleted = "deleted"
+	OrphanHidden  = "hidden"
+)
+
+// OrphanedHighlight is a highlight that was synced to a destination but has since been
+// deleted on the device, so it may need cleaning up at the destination by hand
+type OrphanedHighlight struct {
+	BookmarkID  string `json:"bookmark_id"`
+	Destination string `json:"destination"`
+	VolumeID    string `json:"volume_id"`
+	Text        string `json:"text"`
+	SyncedAt    string `json:"synced_at"`
+	Reason      string `json:"reason"`
+}
+
+func LoadSyncState(portable bool, logger *slog.Logger) (*SyncState, error) {
+	statePath, err := LocateDataFile(syncStateFilename, portable)
+	if err != nil {
+		logger.Error("Failed to create sync state directory. Do you have proper permissions?",
+			slog.String("error", err.Error()),
+		)
+		return nil, err
+	}
+	return loadSyncState(statePath, logger)
+}
+
+func loadSyncState(statePath string, logger *slog.Logger) (*SyncState, error) {
+	logger.Debug("Located sync state path",
+		slog.String("path", statePath),
+	)
+	s := &SyncState{
+		path:         statePath,
+		Destinations: map[string]map[string]SyncEntry{},
+	}
+	b, err := os.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			logger.Info("Sync state file does not exist. Assuming nothing has been synced yet.",
+				slog.String("path", statePath),
+			)
+			return s, nil
+		}
+		logger.Error("Failed to read sync state file",
+			slog.String("error", err.Error()),
+			slog.String("path", statePath),
+		)
+		return nil, err
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		logger.Error("Failed to parse sync state file. Try resetting the sync state to force a full resend.",
+			slog.String("error", err.Error()),
+			slog.String("path", statePath),
+		)
+		return nil, err
+	}
+	if s.Destinations == nil {
+		s.Destinations = map[string]map[string]SyncEntry{}
+	}
+	if len(s.Entries) > 0 {
+		logger.Info("Migrating sync state from before destinations were introduced",
+			slog.Int("entry_count", len(s.Entries)),
+		)
+		if _, ok := s.Destinations[NotadoDestinationName]; !ok {
+			s.Destinations[NotadoDestinationName] = s.Entries
+		}
+		s.Entries = nil
+	}
+	logger.Debug("Loaded sync state",
+		slog.Int("destination_count", len(s.Destinations)),
+	)
+	return s, nil
+}
+
+func (s *SyncState) Save() error {
+	b, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "Failed to save sync state to disc")
+	}
+	err = os.MkdirAll(filepath.Dir(s.path), 0777)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create sync state directory. Do you have proper permissions?")
+	}
+	err = os.WriteFile(s.path, b, 0777)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create sync state file. Do you have proper permissions?")
+	}
+	return nil
+}
+
+// Reset forgets every previously synced bookmark so that the next sync sends everything again
+func (s *SyncState) Reset() error {
+	s.Destinations = map[string]map[string]SyncEntry{}
+	return s.Save()
+}
+
+// FilterUnsynced returns only those bookmarks that have never been synced to the given
+// destination or whose contents have changed since they were last synced there
+func (s *SyncState) FilterUnsynced(destination string, bookmarks []Bookmark) []Bookmark {
+	var pending []Bookmark
+	entries := s.Destinations[destination]
+	for _, bookmark := range bookmarks {
+		entry, ok := entries[bookmark.BookmarkID]
+		if ok && entry.Hash == HashBookmark(bookmark) {
+			continue
+		}
+		pending = append(pending, bookmark)
+	}
+	return pending
+}
+
+// Record marks the given bookmarks as synced to a destination from the given device. The
+// ledger is only updated in memory so callers are expected to call Save afterwards.
+func (s *SyncState) Record(destination string, bookmarks []Bookmark, device string) {
+	syncedAt := time.Now().Format(time.RFC3339)
+	entries, ok := s.Destinations[destination]
+	if !ok {
+		entries = map[string]SyncEntry{}
+		s.Destinations[destination] = entries
+	}
+	for _, bookmark := range bookmarks {
+		entries[bookmark.BookmarkID] = SyncEntry{
+			Hash:     HashBookmark(bookmark),
+			Device:   device,
+			SyncedAt: syncedAt,
+			VolumeID: bookmark.VolumeID,
+			Text:     NormaliseText(bookmark.Text),
+		}
+	}
+}
+
+// Orphaned finds the highlights synced from device that are no longer on it. hidden holds
+// every bookmark on the device and whether it has been hidden, which is how Kobo marks a
+// highlight as deleted. Hidden highlights are only orphaned when they aren't being synced.
+func (s *SyncState) Orphaned(device string, hidden map[string]bool, includeHidden bool) []OrphanedHighlight {
+	orphans := []OrphanedHighlight{}
+	for destination, entries := range s.Destinations {
+		for id, entry := range entries {
+			if entry.Device != device {
+				continue
+			}
+			isHidden, onDevice := hidden[id]
+			reason := ""
+			switch {
+			case !onDevice:
+				reason = OrphanDeleted
+			case isHidden && !includeHidden:
+				reason = OrphanHidden
+			default:
+				continue
+			}
+			orphans = append(orphans, OrphanedHighlight{
+				BookmarkID:  id,
+				Destination: destination,
+				VolumeID:    entry.VolumeID,
+				Text:        entry.Text,
+				SyncedAt:    entry.SyncedAt,
+				Reason:      reason,
+			})
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].Destination != orphans[j].Destination {
+			return orphans[i].Destination < orphans[j].Destination
+		}
+		if orphans[i].SyncedAt != orphans[j].SyncedAt {
+			return orphans[i].SyncedAt < orphans[j].SyncedAt
+		}
+		return orphans[i].BookmarkID < orphans[j].BookmarkID
+	})
+	return orphans
+}
+
+// Forget removes orphaned highlights from the ledger once they have been dealt with. If a
+// hidden highlight is later restored on the device it will be synced again as new.
+func (s *SyncState) Forget(orphans []OrphanedHighlight) {
+	for _, orphan := range orphans {
+		delete(s.Destinations[orphan.Destination], orphan.BookmarkID)
+	}
+}
+
+// HashBookmark fingerprints the parts of a bookmark that a user can edit on their device
+func HashBookmark(bookmark Bookmark) string {
+	h := sha256.New()
+	h.Write([]byte(bookmark.Text))
+	h.Write([]byte{0})
+	h.Write([]byte(bookmark.Annotation))
+	h.Write([]byte{0})
+	h.Write([]byte(bookmark.DateModified))
+	// Recolouring a highlight only changes its colour so it has to be part of the fingerprint
+	// for the new colour's tag to be sent. Firmware without colours leaves it out altogether,
+	// keeping the same fingerprint as before colours were read.
+	if bookmark.Colour != "" {
+		h.Write([]byte{0})
+		h.Write([]byte(bookmark.Colour))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,99 @@
+package backend
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncState_FilterUnsynced(t *testing.T) {
+	state, err := loadSyncState(filepath.Join(t.TempDir(), "sync_state.json"), slog.New(&discardHandler{}))
+	assert.NoError(t, err)
+	synced := Bookmark{BookmarkID: "a", Text: "Hello", DateModified: "2023-01-01T00:00:00Z"}
+	edited := Bookmark{BookmarkID: "b", Text: "World", DateModified: "2023-01-01T00:00:00Z"}
+	state.Record("notado", []Bookmark{synced, edited}, "/mnt/kobo")
+	edited.Annotation = "An afterthought"
+	unseen := Bookmark{BookmarkID: "c", Text: "New"}
+	expected := []Bookmark{edited, unseen}
+	actual := state.FilterUnsynced("notado", []Bookmark{synced, edited, unseen})
+	assert.Equal(t, expected, actual)
+	// Other destinations haven't seen anything yet
+	assert.Equal(t, []Bookmark{synced, edited, unseen}, state.FilterUnsynced("markdown", []Bookmark{synced, edited, unseen}))
+}
+
+func TestSyncState_RecolouredHighlightsAreUnsynced(t *testing.T) {
+	state, err := loadSyncState(filepath.Join(t.TempDir(), "sync_state.json"), slog.New(&discardHandler{}))
+	assert.NoError(t, err)
+	uncoloured := Bookmark{BookmarkID: "a", Text: "Hello", DateModified: "2023-01-01T00:00:00Z"}
+	coloured := Bookmark{BookmarkID: "b", Text: "World", DateModified: "2023-01-01T00:00:00Z", Colour: HighlightColourYellow}
+	state.Record("notado", []Bookmark{uncoloured, coloured}, "/mnt/kobo")
+	assert.Empty(t, state.FilterUnsynced("notado", []Bookmark{uncoloured, coloured}))
+
+	coloured.Colour = HighlightColourBlue
+	assert.Equal(t, []Bookmark{coloured}, state.FilterUnsynced("notado", []Bookmark{uncoloured, coloured}))
+	// A bookmark from firmware without colours keeps the fingerprint it had before colours were
+	// read so that upgrading doesn't send everything again
+	assert.Equal(t, "9d3aeb7080353bd1a67c7d6de1e30985ef79d9a5ce73503b047b47bdf2df3318", HashBookmark(Bookmark{Text: "Hello"}))
+}
+
+func TestSyncState_PersistAndReset(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "october", "sync_state.json")
+	state, err := loadSyncState(statePath, slog.New(&discardHandler{}))
+	assert.NoError(t, err)
+	bookmark := Bookmark{BookmarkID: "a", Text: "Hello"}
+	state.Record("notado", []Bookmark{bookmark}, "/mnt/kobo")
+	assert.NoError(t, state.Save())
+
+	reloaded, err := loadSyncState(statePath, slog.New(&discardHandler{}))
+	assert.NoError(t, err)
+	assert.Equal(t, "/mnt/kobo", reloaded.Destinations["notado"]["a"].Device)
+	assert.Empty(t, reloaded.FilterUnsynced("notado", []Bookmark{bookmark}))
+
+	assert.NoError(t, reloaded.Reset())
+	reset, err := loadSyncState(statePath, slog.New(&discardHandler{}))
+	assert.NoError(t, err)
+	assert.Equal(t, []Bookmark{bookmark}, reset.FilterUnsynced("notado", []Bookmark{bookmark}))
+}
+
+func TestSyncState_MigratesLegacyEntries(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "sync_state.json")
+	legacy := `{"entries": {"a": {"hash": "abc", "device": "/mnt/kobo", "synced_at": "2024-01-01T00:00:00Z"}}}`
+	assert.NoError(t, os.WriteFile(statePath, []byte(legacy), 0666))
+	state, err := loadSyncState(statePath, slog.New(&discardHandler{}))
+	assert.NoError(t, err)
+	assert.Nil(t, state.Entries)
+	assert.Equal(t, "abc", state.Destinations["notado"]["a"].Hash)
+}
+
+func TestSyncState_Orphaned(t *testing.T) {
+	state, err := loadSyncState(filepath.Join(t.TempDir(), "sync_state.json"), slog.New(&discardHandler{}))
+	assert.NoError(t, err)
+	state.Record("notado", []Bookmark{
+		{BookmarkID: "visible", Text: "Still here"},
+		{BookmarkID: "hidden", VolumeID: "book", Text: "Deleted on the device"},
+		{BookmarkID: "gone", Text: "Removed entirely"},
+	}, "N123")
+	state.Record("notado", []Bookmark{{BookmarkID: "elsewhere"}}, "N456")
+	onDevice := map[string]bool{"visible": false, "hidden": true}
+
+	orphans := state.Orphaned("N123", onDevice, false)
+	assert.Len(t, orphans, 2)
+	byID := map[string]OrphanedHighlight{}
+	for _, orphan := range orphans {
+		byID[orphan.BookmarkID] = orphan
+	}
+	assert.Equal(t, OrphanHidden, byID["hidden"].Reason)
+	assert.Equal(t, "book", byID["hidden"].VolumeID)
+	assert.Equal(t, OrphanDeleted, byID["gone"].Reason)
+	assert.Equal(t, "Removed entirely", byID["gone"].Text)
+
+	// Hidden highlights are still being synced when they are included so they aren't orphaned
+	assert.Len(t, state.Orphaned("N123", onDevice, true), 1)
+
+	state.Forget(orphans)
+	assert.Empty(t, state.Orphaned("N123", onDevice, false))
+	assert.Len(t, state.Destinations["notado"], 2)
+}
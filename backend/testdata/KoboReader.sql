@@ -0,0 +1,90 @@
+-- A cut down KoboReader.sqlite containing only the tables and columns that October reads.
+-- Tests load this into a temporary database so that the sync pipeline can run offline.
+CREATE TABLE DbVersion (
+	version INTEGER
+);
+
+INSERT INTO DbVersion VALUES (174);
+
+CREATE TABLE content (
+	ContentID TEXT NOT NULL,
+	ContentType TEXT NOT NULL,
+	MimeType TEXT NOT NULL,
+	BookID TEXT,
+	BookTitle TEXT,
+	ImageId TEXT,
+	Title TEXT COLLATE NOCASE,
+	Attribution TEXT COLLATE NOCASE,
+	Description TEXT,
+	DateCreated TEXT,
+	Publisher TEXT,
+	DateLastRead TEXT,
+	VolumeIndex INTEGER,
+	___NumPages INTEGER NOT NULL DEFAULT -1,
+	ReadStatus INTEGER,
+	___SyncTime TEXT,
+	___UserID TEXT NOT NULL,
+	___FileOffset INTEGER,
+	___FileSize INTEGER,
+	___PercentRead INTEGER,
+	ISBN TEXT,
+	Series TEXT,
+	SeriesNumber TEXT,
+	WordCount INTEGER DEFAULT -1,
+	TimesStartedReading INTEGER DEFAULT 0,
+	TimeSpentReading INTEGER DEFAULT 0,
+	LastTimeStartedReading TEXT,
+	LastTimeFinishedReading TEXT,
+	Depth INTEGER,
+	PRIMARY KEY (ContentID)
+);
+
+CREATE TABLE Bookmark (
+	BookmarkID TEXT NOT NULL,
+	VolumeID TEXT NOT NULL,
+	ContentID TEXT NOT NULL,
+	StartContainerPath TEXT NOT NULL,
+	StartContainerChildIndex INTEGER NOT NULL,
+	StartOffset INTEGER NOT NULL,
+	EndContainerPath TEXT NOT NULL,
+	EndContainerChildIndex INTEGER NOT NULL,
+	EndOffset INTEGER NOT NULL,
+	Text TEXT,
+	Annotation TEXT,
+	ExtraAnnotationData BLOB,
+	DateCreated TEXT,
+	ChapterProgress REAL NOT NULL DEFAULT 0,
+	Hidden BOOL NOT NULL DEFAULT 0,
+	Version TEXT,
+	DateModified TEXT,
+	Creator TEXT,
+	UUID TEXT,
+	UserID TEXT,
+	SyncTime TEXT,
+	Published BOOL DEFAULT false,
+	ContextString TEXT,
+	Type TEXT,
+	PRIMARY KEY (BookmarkID)
+);
+
+-- Books
+INSERT INTO content (ContentID, ContentType, MimeType, BookID, BookTitle, Title, Attribution, Publisher, DateLastRead, VolumeIndex, ReadStatus, ___UserID, ___FileSize, ___PercentRead, ISBN, Series, SeriesNumber, WordCount, TimesStartedReading, TimeSpentReading, LastTimeStartedReading, LastTimeFinishedReading, Depth) VALUES
+	('file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub', '6', 'application/x-kobo-epub+zip', NULL, NULL, 'Dune', 'Frank Herbert', 'Ace', '2023-03-02T21:14:00Z', -1, 2, 'adobe_user', 1200, 100, '9780441013593', 'Dune', '1', 188000, 6, 36000, '2023-03-02T20:14:00Z', '2023-03-02T21:14:00Z', 0),
+	('file:///mnt/onboard/Austen, Jane/Emma - Jane Austen.epub', '6', 'application/epub+zip', NULL, NULL, 'Emma', 'Jane Austen', 'Penguin', '2023-04-10T08:00:00Z', -1, 1, 'adobe_user', 600, 42, '9780141439587', NULL, NULL, 160000, 3, 7200, '2023-04-10T07:00:00Z', NULL, 0),
+	('5c1b1a9c-2bd2-4ba1-9d1e-4a3c9b2b7f10', '6', 'application/x-kobo-epub+zip', NULL, NULL, 'Meditations', 'Marcus Aurelius', 'Penguin', '2023-01-15T12:00:00Z', -1, 2, 'kobo_user', 400, 100, '9780140449334', NULL, NULL, 60000, 2, 5400, '2023-01-15T11:00:00Z', '2023-01-15T12:00:00Z', 0);
+
+-- Chapters
+INSERT INTO content (ContentID, ContentType, MimeType, BookID, BookTitle, Title, Attribution, VolumeIndex, ___UserID, ___FileSize, Depth) VALUES
+	('file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub!!OEBPS/ch01.xhtml', '9', 'application/xhtml+xml', 'file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub', 'Dune', 'Book One: Dune', NULL, 0, 'adobe_user', 400, 1),
+	('file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub!!OEBPS/ch02.xhtml', '9', 'application/xhtml+xml', 'file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub', 'Dune', 'Book Two: Muad''Dib', NULL, 1, 'adobe_user', 800, 1),
+	('file:///mnt/onboard/Austen, Jane/Emma - Jane Austen.epub#(0)OEBPS/chapter1.html', '9', 'application/xhtml+xml', 'file:///mnt/onboard/Austen, Jane/Emma - Jane Austen.epub', 'Emma', 'Chapter I', NULL, 0, 'adobe_user', 600, 1),
+	('5c1b1a9c-2bd2-4ba1-9d1e-4a3c9b2b7f10!OEBPS!book2.xhtml', '899', 'application/xhtml+xml', '5c1b1a9c-2bd2-4ba1-9d1e-4a3c9b2b7f10', 'Meditations', 'Book Two', NULL, 0, 'kobo_user', 400, 1);
+
+-- Highlights, notes and a dogear
+INSERT INTO Bookmark (BookmarkID, VolumeID, ContentID, StartContainerPath, StartContainerChildIndex, StartOffset, EndContainerPath, EndContainerChildIndex, EndOffset, Text, Annotation, DateCreated, ChapterProgress, Hidden, DateModified, ContextString, Type) VALUES
+	('b1000000-0000-0000-0000-000000000001', 'file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub', 'file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub!!OEBPS/ch01.xhtml', 'span#kobo\.12\.1', 0, 0, 'span#kobo\.12\.1', 0, 25, 'I must not fear.
+Fear is the mind-killer.', '', '2023-03-01T20:00:00.000', 0.5, 'false', '2023-03-01T20:00:00Z', 'I must not fear. Fear is the mind-killer. Fear is the little-death that brings total obliteration.', 'highlight'),
+	('b1000000-0000-0000-0000-000000000002', 'file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub', 'file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub!!OEBPS/ch02.xhtml', 'span#kobo\.3\.2', 0, 4, 'span#kobo\.3\.2', 0, 40, 'The mystery of life isn''t a problem to solve', 'A favourite .quote .philosophy', '2023-03-02T21:00:00.000', 0.1, 'false', '2023-03-02T21:00:00Z', '', 'note'),
+	('b1000000-0000-0000-0000-000000000003', 'file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub', 'file:///mnt/onboard/Herbert, Frank/Dune - Frank Herbert.kepub.epub!!OEBPS/ch02.xhtml', 'span#kobo\.9\.1', 0, 0, 'span#kobo\.9\.1', 0, 0, NULL, NULL, '2023-03-02T21:10:00.000', 0.8, 'false', '2023-03-02T21:10:00Z', NULL, 'dogear'),
+	('b1000000-0000-0000-0000-000000000004', 'file:///mnt/onboard/Austen, Jane/Emma - Jane Austen.epub', 'file:///mnt/onboard/Austen, Jane/Emma - Jane Austen.epub#(0)OEBPS/chapter1.html', '/1/4/2/1:0', 0, 0, '/1/4/2/1:0', 0, 18, 'Emma Woodhouse, handsome, clever, and rich', '', '2023-04-10T07:30:00.000', 0.02, 'false', '2023-04-10T07:30:00Z', NULL, 'highlight'),
+	('b1000000-0000-0000-0000-000000000005', '5c1b1a9c-2bd2-4ba1-9d1e-4a3c9b2b7f10', '5c1b1a9c-2bd2-4ba1-9d1e-4a3c9b2b7f10!OEBPS!book2.xhtml', 'span#kobo\.1\.1', 0, 0, 'span#kobo\.1\.1', 0, 30, 'Begin the morning by saying to thyself', '', '2023-01-15T11:30:00.000', 0.05, 'false', '2023-01-15T11:30:00Z', NULL, 'highlight');
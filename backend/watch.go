@@ -0,0 +1,169 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/pgaskin/koboutils/v2/kobo"
+)
+
+const (
+	WATCH_POLL_INTERVAL = 5 * time.Second
+	WATCH_DEBOUNCE      = 10 * time.Second
+	WATCH_RETRY_BACKOFF = 30 * time.Second
+	WATCH_MAX_BACKOFF   = 15 * time.Minute
+)
+
+// Watcher polls for kobos being plugged in and hands each one over once it has stayed mounted
+// for long enough that the device has finished mounting and released its database
+type Watcher struct {
+	logger     *slog.Logger
+	interval   time.Duration
+	debounce   time.Duration
+	backoff    time.Duration
+	maxBackoff time.Duration
+	find       func() ([]string, error)
+	onDevice   func(ctx context.Context, path string) error
+
+	// arrived tracks when each mounted device was first seen and handled tracks those that
+	// have already been passed on, so that a device is only synced once per plug in
+	arrived map[string]time.Time
+	handled map[string]bool
+	// failures counts how many times in a row each device has failed and retryAt holds off
+	// trying it again so that a device that keeps failing doesn't fill the log
+	failures map[string]int
+	retryAt  map[string]time.Time
+}
+
+// NewWatcher calls onDevice with the mount path of each kobo that is plugged in. When onDevice
+// returns an error the device is tried again while it stays plugged in, waiting twice as long
+// after each failure up to WATCH_MAX_BACKOFF. Devices with no highlights or destinations
+// without a token aren't tried again until they are plugged back in.
+func NewWatcher(interval time.Duration, debounce time.Duration, onDevice func(ctx context.Context, path string) error, logger *slog.Logger) *Watcher {
+	return &Watcher{
+		logger:     logger,
+		interval:   interval,
+		debounce:   debounce,
+		backoff:    WATCH_RETRY_BACKOFF,
+		maxBackoff: WATCH_MAX_BACKOFF,
+		find:       kobo.Find,
+		onDevice:   onDevice,
+		arrived:    map[string]time.Time{},
+		handled:    map[string]bool{},
+		failures:   map[string]int{},
+		retryAt:    map[string]time.Time{},
+	}
+}
+
+// Run polls until ctx is cancelled. Devices that are already plugged in when the watcher
+// starts are treated as having just arrived.
+func (w *Watcher) Run(ctx context.Context) error {
+	w.logger.Info("Watching for kobos",
+		slog.Duration("interval", w.interval),
+		slog.Duration("debounce", w.debounce),
+	)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		for _, path := range w.poll(time.Now()) {
+			err := w.onDevice(ctx, path)
+			if err != nil && !worthRetrying(err) {
+				// The device stays handled until it is plugged in again since trying again
+				// can't help until the user changes something
+				w.logger.Warn("Kobo can't be synced so it won't be tried again until it is plugged back in",
+					slog.String("error", err.Error()),
+					slog.String("mount_path", path),
+				)
+				err = nil
+			}
+			if err != nil {
+				retryIn := w.failed(path, time.Now())
+				w.logger.Error("Failed to handle kobo so it will be tried again",
+					slog.String("error", err.Error()),
+					slog.String("mount_path", path),
+					slog.Duration("retry_in", retryIn),
+				)
+			} else {
+				delete(w.failures, path)
+				delete(w.retryAt, path)
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Stopped watching for kobos")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll checks which devices are mounted and returns those that have been settled for the
+// debounce period without being handled yet
+func (w *Watcher) poll(now time.Time) []string {
+	paths, err := w.find()
+	if err != nil {
+		w.logger.Error("Failed to look for connected kobos",
+			slog.String("error", err.Error()),
+		)
+		return nil
+	}
+	mounted := map[string]bool{}
+	for _, path := range paths {
+		mounted[path] = true
+		if _, ok := w.arrived[path]; !ok {
+			w.logger.Info("Kobo was plugged in",
+				slog.String("mount_path", path),
+			)
+			w.arrived[path] = now
+		}
+	}
+	for path := range w.arrived {
+		if !mounted[path] {
+			w.logger.Info("Kobo was unplugged",
+				slog.String("mount_path", path),
+			)
+			delete(w.arrived, path)
+			delete(w.handled, path)
+			delete(w.failures, path)
+			delete(w.retryAt, path)
+		}
+	}
+	var ready []string
+	for _, path := range paths {
+		if !w.handled[path] && now.Sub(w.arrived[path]) >= w.debounce && !now.Before(w.retryAt[path]) {
+			w.handled[path] = true
+			ready = append(ready, path)
+		}
+	}
+	return ready
+}
+
+// worthRetrying reports whether a device might sync if it is tried again while it stays plugged
+// in. A device with nothing to send or a destination without a token will only fail the same
+// way, unless a destination also failed for a reason that may pass.
+func worthRetrying(err error) bool {
+	var noHighlights *NoHighlightsError
+	if !errors.As(err, &noHighlights) && !IsMissingTokenError(err) {
+		return true
+	}
+	return IsNetworkError(err)
+}
+
+// failed schedules another attempt at a device that couldn't be handled and returns how long
+// until it is tried again
+func (w *Watcher) failed(path string, now time.Time) time.Duration {
+	w.failures[path]++
+	wait := w.backoff
+	for i := 1; i < w.failures[path] && wait < w.maxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, w.maxBackoff)
+	w.retryAt[path] = now.Add(wait)
+	delete(w.handled, path)
+	return wait
+}
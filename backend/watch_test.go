@@ -0,0 +1,129 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher_Poll(t *testing.T) {
+	var mounted []string
+	w := NewWatcher(time.Second, 10*time.Second, nil, slog.New(&discardHandler{}))
+	w.find = func() ([]string, error) { return mounted, nil }
+	start := time.Date(2023, 3, 2, 21, 0, 0, 0, time.UTC)
+
+	assert.Empty(t, w.poll(start))
+
+	mounted = []string{"/media/libra"}
+	assert.Empty(t, w.poll(start.Add(time.Second)), "devices wait out the debounce before syncing")
+	assert.Empty(t, w.poll(start.Add(5*time.Second)))
+	assert.Equal(t, []string{"/media/libra"}, w.poll(start.Add(11*time.Second)))
+	assert.Empty(t, w.poll(start.Add(20*time.Second)), "a device is only synced once per plug in")
+
+	mounted = nil
+	assert.Empty(t, w.poll(start.Add(21*time.Second)))
+	mounted = []string{"/media/libra"}
+	assert.Empty(t, w.poll(start.Add(22*time.Second)))
+	assert.Equal(t, []string{"/media/libra"}, w.poll(start.Add(32*time.Second)), "plugging back in syncs again")
+}
+
+func TestWatcher_RunStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var synced []string
+	w := NewWatcher(time.Millisecond, 0, func(ctx context.Context, path string) error {
+		synced = append(synced, path)
+		cancel()
+		return nil
+	}, slog.New(&discardHandler{}))
+	w.find = func() ([]string, error) { return []string{"/media/libra"}, nil }
+
+	assert.NoError(t, w.Run(ctx))
+	assert.Equal(t, []string{"/media/libra"}, synced)
+}
+
+func TestWatcher_RetriesDevicesThatFailed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var attempts int
+	w := NewWatcher(time.Millisecond, 0, func(ctx context.Context, path string) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("failed to read .kobo/version")
+		}
+		cancel()
+		return nil
+	}, slog.New(&discardHandler{}))
+	w.backoff = time.Millisecond
+	w.find = func() ([]string, error) { return []string{"/media/libra"}, nil }
+
+	assert.NoError(t, w.Run(ctx))
+	assert.Equal(t, 2, attempts)
+	assert.Empty(t, w.failures, "a device that succeeds starts over with no backoff")
+}
+
+func TestWatcher_BacksOffDevicesThatKeepFailing(t *testing.T) {
+	mounted := []string{"/media/libra"}
+	w := NewWatcher(time.Second, 0, nil, slog.New(&discardHandler{}))
+	w.find = func() ([]string, error) { return mounted, nil }
+	start := time.Date(2023, 3, 2, 21, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, mounted, w.poll(start))
+	assert.Equal(t, WATCH_RETRY_BACKOFF, w.failed("/media/libra", start))
+	assert.Empty(t, w.poll(start.Add(time.Second)), "a failed device waits before it is tried again")
+	assert.Equal(t, mounted, w.poll(start.Add(WATCH_RETRY_BACKOFF)))
+	assert.Equal(t, 2*WATCH_RETRY_BACKOFF, w.failed("/media/libra", start.Add(WATCH_RETRY_BACKOFF)))
+	assert.Empty(t, w.poll(start.Add(2*WATCH_RETRY_BACKOFF)))
+	assert.Equal(t, mounted, w.poll(start.Add(3*WATCH_RETRY_BACKOFF)))
+	for i := 0; i < 10; i++ {
+		w.failed("/media/libra", start)
+	}
+	assert.Equal(t, WATCH_MAX_BACKOFF, w.retryAt["/media/libra"].Sub(start), "the wait never grows past the maximum")
+
+	// Unplugging a device forgets that it failed
+	mounted = nil
+	assert.Empty(t, w.poll(start.Add(time.Minute)))
+	mounted = []string{"/media/libra"}
+	assert.Equal(t, mounted, w.poll(start.Add(2*time.Minute)))
+}
+
+func TestWatcher_DoesNotRetryWhatCantSucceed(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+	}{
+		{"no highlights", &NoHighlightsError{Message: "nothing to sync"}},
+		{"missing token", fmt.Errorf("failed to sync: %w", &MissingTokenError{Destination: NotadoDestinationName})},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var attempts int
+			w := NewWatcher(time.Millisecond, 0, func(ctx context.Context, path string) error {
+				attempts++
+				return tc.err
+			}, slog.New(&discardHandler{}))
+			w.backoff = time.Millisecond
+			polls := 0
+			w.find = func() ([]string, error) {
+				if polls++; polls == 20 {
+					cancel()
+				}
+				return []string{"/media/libra"}, nil
+			}
+
+			assert.NoError(t, w.Run(ctx))
+			assert.Equal(t, 1, attempts)
+			assert.Empty(t, w.failures)
+			assert.True(t, w.handled["/media/libra"])
+		})
+	}
+
+	assert.True(t, worthRetrying(errors.Join(&MissingTokenError{Destination: ReadwiseDestinationName}, &NotadoServerError{StatusCode: 502})),
+		"a destination that may recover is still retried")
+	assert.True(t, worthRetrying(errors.New("failed to read .kobo/version")))
+}
@@ -2,9 +2,15 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
 
 	"github.com/marcus-crane/october/backend"
 	"github.com/urfave/cli/v2"
@@ -19,7 +25,173 @@ func IsCLIInvokedExplicitly(args []string) bool {
 	return false
 }
 
+// describeNotadoError adds a hint about what the user can do next for errors that Notado reported
+func describeNotadoError(err error) error {
+	var authErr *backend.NotadoAuthError
+	var validationErr *backend.NotadoValidationError
+	var serverErr *backend.NotadoServerError
+	var readwiseAuthErr *backend.ReadwiseAuthError
+	switch {
+	case backend.IsMissingTokenError(err):
+		var missing *backend.MissingTokenError
+		errors.As(err, &missing)
+		return fmt.Errorf("%w. you can set one with `noctober cli config set-token --destination %s`", err, missing.Destination)
+	case errors.As(err, &authErr):
+		return fmt.Errorf("%w. you can find your access token at https://notado.app/settings", err)
+	case errors.As(err, &readwiseAuthErr):
+		return fmt.Errorf("%w. you can find your access token at %s", err, backend.READWISE_TOKEN_URL)
+	case errors.As(err, &validationErr):
+		return fmt.Errorf("%w. this highlight will need to be edited on your kobo before it can be synced", err)
+	case errors.As(err, &serverErr):
+		return fmt.Errorf("%w. this is likely temporary so try syncing again later", err)
+	}
+	return err
+}
+
+// selectKobo connects to the database given with --db or --mount, falling back to the one kobo
+// that is plugged in and refusing to guess if there are several
+func selectKobo(c *cli.Context, b *backend.Backend) error {
+	dbPath := c.String("db")
+	mntPath := c.String("mount")
+	if dbPath == "" && mntPath != "" {
+		dbPath = filepath.Join(mntPath, ".kobo", "KoboReader.sqlite")
+	}
+	if dbPath != "" {
+		return withExitCode(exitNoDevice, b.SelectLocalKobo(dbPath, mntPath))
+	}
+	kobos, err := b.DetectKobos()
+	if err != nil {
+		return withExitCode(exitNoDevice, err)
+	}
+	if len(kobos) == 0 {
+		return withExitCode(exitNoDevice, fmt.Errorf("no kobo was found. have you plugged one in and accepted the connection request?"))
+	}
+	selected := kobos[0]
+	if query := c.String("device"); query != "" {
+		kb, err := backend.FindKobo(kobos, query)
+		if err != nil {
+			return withExitCode(exitNoDevice, err)
+		}
+		selected = kb
+	} else if len(kobos) > 1 {
+		return withExitCode(exitUsage, fmt.Errorf("%d kobos are connected. pick one with --device or sync them all with --all-devices", len(kobos)))
+	}
+	if err := b.SelectKobo(selected.MntPath); err != nil {
+		return withExitCode(exitNoDevice, fmt.Errorf("an error occurred trying to connect to the kobo at %s", selected.MntPath))
+	}
+	return nil
+}
+
+// syncDevice syncs a detected kobo
+func syncDevice(b *backend.Backend, kb backend.Kobo, destinations []string) deviceSummary {
+	summary := deviceSummary{Kobo: kb}
+	if err := b.SelectKobo(kb.MntPath); err != nil {
+		return summary.failed(withExitCode(exitNoDevice, fmt.Errorf("an error occurred trying to connect to the kobo at %s", kb.MntPath)))
+	}
+	summary.Kobo = b.SelectedKobo
+	results, err := b.SyncHighlightsTo(destinations)
+	summary.Destinations = results
+	if err != nil {
+		return summary.failed(syncExitCode(results, describeNotadoError(err)))
+	}
+	return summary
+}
+
+// syncMountedDevice syncs whichever kobo is mounted at path. Every kobo mounts at the same path
+// on some systems so the device is always detected again rather than trusting an earlier one.
+func syncMountedDevice(b *backend.Backend, path string, destinations []string) (deviceSummary, error) {
+	if _, err := b.DetectKobos(); err != nil {
+		return deviceSummary{}, err
+	}
+	kb, ok := b.ConnectedKobos[path]
+	if !ok {
+		return deviceSummary{}, fmt.Errorf("the kobo at %s is no longer connected", path)
+	}
+	return syncDevice(b, kb, destinations), nil
+}
+
+func (s deviceSummary) failed(err error) deviceSummary {
+	s.Err = err
+	s.Error = err.Error()
+	return s
+}
+
+// syncAllDevices syncs every connected kobo in turn, carrying on past failures so that one
+// troublesome device doesn't hold up the rest
+func syncAllDevices(c *cli.Context, b *backend.Backend, destinations []string) error {
+	kobos, err := b.DetectKobos()
+	if err != nil {
+		return withExitCode(exitNoDevice, err)
+	}
+	if len(kobos) == 0 {
+		return withExitCode(exitNoDevice, fmt.Errorf("no kobo was found. have you plugged one in and accepted the connection request?"))
+	}
+	summaries := []deviceSummary{}
+	var failures []error
+	for _, kb := range kobos {
+		summary := syncDevice(b, kb, destinations)
+		if summary.Err != nil {
+			failures = append(failures, summary.Err)
+		}
+		summaries = append(summaries, summary)
+	}
+	switch {
+	case len(failures) == 1 && len(kobos) == 1:
+		err = failures[0]
+	case len(failures) == len(kobos):
+		// Keep the first device's reason so that the exit code says why syncing failed
+		err = fmt.Errorf("%d of %d kobos failed to sync: %w", len(failures), len(kobos), failures[0])
+	case len(failures) > 0:
+		err = withExitCode(exitPartial, fmt.Errorf("%d of %d kobos failed to sync", len(failures), len(kobos)))
+	}
+	return finish(c, allDevicesResult{Devices: summaries}, err, func(w io.Writer) error {
+		return printDeviceSummaries(w, summaries)
+	})
+}
+
 func Invoke(isPortable bool, version string, logger *slog.Logger) {
+	// Everything is still written to the log file but people running the cli also want to see
+	// what is happening, so info and above is echoed to stderr where it can't corrupt results
+	terminalLevel := &slog.LevelVar{}
+	logger = withTerminalLog(logger, os.Stderr, terminalLevel)
+	slog.SetDefault(logger)
+
+	// startBackend applies any global flags on top of the saved settings
+	startBackend := func(c *cli.Context) (*backend.Backend, error) {
+		// Using the cli context means that syncs are abandoned if the user interrupts the cli
+		ctx := c.Context
+		b, err := backend.StartBackend(&ctx, version, isPortable, logger)
+		if err != nil {
+			return nil, err
+		}
+		if endpoint := c.String("notado-endpoint"); endpoint != "" {
+			logger.Info("Using Notado endpoint from command line",
+				slog.String("endpoint", endpoint),
+			)
+			b.Notado.SetEndpoint(endpoint)
+		}
+		if endpoint := c.String("readwise-endpoint"); endpoint != "" {
+			logger.Info("Using Readwise endpoint from command line",
+				slog.String("endpoint", endpoint),
+			)
+			b.Readwise.SetEndpoint(endpoint)
+		}
+		return b, nil
+	}
+
+	// syncDestinations picks the destinations for a sync and makes sure that Notado has a token
+	// before anything is read from the kobo
+	syncDestinations := func(c *cli.Context, b *backend.Backend) ([]string, error) {
+		destinations := c.StringSlice("destination")
+		if len(destinations) == 0 {
+			destinations = b.Settings.Destinations
+		}
+		if slices.Contains(destinations, backend.NotadoDestinationName) && b.Settings.NotadoToken == "" {
+			return nil, withExitCode(exitNoToken, fmt.Errorf("no notado token was configured. you can set one with `noctober cli config set-token`"))
+		}
+		return destinations, nil
+	}
+
 	app := &cli.App{
 		Name:     "noctober cli",
 		HelpName: "noctober cli",
@@ -30,39 +202,535 @@ func Invoke(isPortable bool, version string, logger *slog.Logger) {
 				Email: "support@notado.app",
 			},
 		},
-		Usage: "sync your kobo highlights to notado from your terminal",
+		Usage:       "sync your kobo highlights to notado from your terminal",
+		Description: "Every command accepts --output json, which prints a single object with the fields command, ok, exit_code, error and result.\n\n" + exitCodesHelp,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "notado-endpoint",
+				Usage: fmt.Sprintf("graphql endpoint to send highlights to instead of the one in settings or $%s", backend.NotadoEndpointEnv),
+			},
+			&cli.StringFlag{
+				Name:  "db",
+				Usage: "read highlights from this copy of KoboReader.sqlite instead of a connected kobo",
+			},
+			&cli.StringFlag{
+				Name:  "mount",
+				Usage: "folder holding the kobo's files, such as a backup of the device. used alongside --db or on its own when the kobo isn't detected",
+			},
+			&cli.StringFlag{
+				Name:  "device",
+				Usage: "serial, mount path or name of the connected kobo to use when there are several",
+			},
+			&cli.StringFlag{
+				Name:  "readwise-endpoint",
+				Usage: fmt.Sprintf("highlights endpoint to send readwise highlights to instead of the one in $%s", backend.ReadwiseEndpointEnv),
+			},
+			outputFlag(),
+			&cli.BoolFlag{
+				Name:  "quiet",
+				Usage: "only print errors to the terminal. everything is still written to the log file",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			if c.Bool("quiet") {
+				terminalLevel.Set(slog.LevelError)
+			}
+			return nil
+		},
+		// Commands exit from here so that the exit code reflects why they failed
+		ExitErrHandler: func(c *cli.Context, err error) {
+			if err == nil {
+				return
+			}
+			code := exitCode(err)
+			logger.Error(err.Error(),
+				slog.Int("exit_code", code),
+			)
+			var reported *reportedError
+			if outputFormat(c) == outputJSON && !errors.As(err, &reported) {
+				_ = writeJSON(c.App.Writer, newCommandResult(c, nil, err), true)
+			}
+			os.Exit(code)
+		},
 		Commands: []*cli.Command{
 			{
 				Name:    "sync",
 				Aliases: []string{"s"},
-				Usage:   "sync kobo highlights to notado",
+				Usage:   "sync kobo highlights to notado and any other enabled destinations",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "print what would be sent to notado without sending anything",
+					},
+					outputFlag(),
+					&cli.BoolFlag{
+						Name:  "all-devices",
+						Usage: "sync every connected kobo one after another",
+					},
+					&cli.StringSliceFlag{
+						Name:  "destination",
+						Usage: fmt.Sprintf("destination to sync to instead of those enabled in settings. can be repeated. one of %v", backend.AvailableDestinations()),
+					},
+				},
+				Action: func(c *cli.Context) error {
+					b, err := startBackend(c)
+					if err != nil {
+						return err
+					}
+					dryRun := c.Bool("dry-run")
+					if c.Bool("all-devices") {
+						if dryRun || c.IsSet("db") || c.IsSet("mount") || c.IsSet("device") {
+							return withExitCode(exitUsage, fmt.Errorf("--all-devices can't be combined with --dry-run, --db, --mount or --device"))
+						}
+						destinations, err := syncDestinations(c, b)
+						if err != nil {
+							return err
+						}
+						return syncAllDevices(c, b, destinations)
+					}
+					if dryRun {
+						if err := selectKobo(c, b); err != nil {
+							return err
+						}
+						preview, err := b.PreviewNotadoSync()
+						if err != nil {
+							return err
+						}
+						return finish(c, preview, nil, func(w io.Writer) error {
+							return printPreview(w, preview)
+						})
+					}
+					destinations, err := syncDestinations(c, b)
+					if err != nil {
+						return err
+					}
+					if err := selectKobo(c, b); err != nil {
+						return err
+					}
+					summary := deviceSummary{Kobo: b.SelectedKobo}
+					results, err := b.SyncHighlightsTo(destinations)
+					summary.Destinations = results
+					for _, result := range results {
+						if result.Err != nil {
+							continue
+						}
+						logger.Info("Successfully synced highlights",
+							slog.String("destination", result.Destination),
+							slog.Int("count", result.Sent),
+						)
+					}
+					if err != nil {
+						summary = summary.failed(syncExitCode(results, describeNotadoError(err)))
+					}
+					return finish(c, summary, summary.Err, nil)
+				},
+			},
+			{
+				Name:  "devices",
+				Usage: "list the kobos that are plugged in",
+				Flags: []cli.Flag{
+					outputFlag(),
+				},
+				Action: func(c *cli.Context) error {
+					b, err := startBackend(c)
+					if err != nil {
+						return err
+					}
+					kobos, err := b.DetectKobos()
+					if err != nil {
+						return withExitCode(exitNoDevice, err)
+					}
+					if kobos == nil {
+						kobos = []backend.Kobo{}
+					}
+					return finish(c, kobos, nil, func(w io.Writer) error {
+						return printDevices(w, kobos)
+					})
+				},
+			},
+			{
+				Name:  "watch",
+				Usage: "stay running and sync each kobo as soon as it is plugged in. with --output json each sync is printed as one line",
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  "interval",
+						Usage: "how often to check for newly plugged in kobos",
+						Value: backend.WATCH_POLL_INTERVAL,
+					},
+					&cli.DurationFlag{
+						Name:  "debounce",
+						Usage: "how long a kobo must stay plugged in before syncing so that it can finish mounting",
+						Value: backend.WATCH_DEBOUNCE,
+					},
+					&cli.StringSliceFlag{
+						Name:  "destination",
+						Usage: fmt.Sprintf("destination to sync to instead of those enabled in settings. can be repeated. one of %v", backend.AvailableDestinations()),
+					},
+					outputFlag(),
+				},
+				Action: func(c *cli.Context) error {
+					b, err := startBackend(c)
+					if err != nil {
+						return err
+					}
+					destinations, err := syncDestinations(c, b)
+					if err != nil {
+						return err
+					}
+					format := outputFormat(c)
+					if format != outputText && format != outputJSON {
+						return withExitCode(exitUsage, fmt.Errorf("unknown output format %q. expected %s or %s", format, outputText, outputJSON))
+					}
+					fmt.Fprintln(c.App.ErrWriter, "Watching for kobos. Press Ctrl+C to stop.")
+					watcher := backend.NewWatcher(c.Duration("interval"), c.Duration("debounce"), func(ctx context.Context, path string) error {
+						summary, err := syncMountedDevice(b, path, destinations)
+						if err != nil {
+							return err
+						}
+						if format == outputJSON {
+							_ = writeJSON(c.App.Writer, newCommandResult(c, summary, summary.Err), false)
+						} else {
+							_ = printDeviceSummaries(c.App.Writer, []deviceSummary{summary})
+						}
+						// A sync that failed is retried the same as a device that couldn't be read,
+						// unless there was nothing to send or a token is missing. Highlights that did
+						// make it are remembered so they aren't sent twice.
+						return summary.Err
+					}, logger)
+					return watcher.Run(c.Context)
+				},
+			},
+			{
+				Name:  "backup",
+				Usage: "save a copy of your kobo's database and annotations",
+				Flags: []cli.Flag{
+					outputFlag(),
+				},
+				Action: func(c *cli.Context) error {
+					b, err := startBackend(c)
+					if err != nil {
+						return err
+					}
+					if err := selectKobo(c, b); err != nil {
+						return err
+					}
+					info, err := b.BackupKobo()
+					if err != nil {
+						return err
+					}
+					return finish(c, info, nil, func(w io.Writer) error {
+						_, err := fmt.Fprintf(w, "Saved backup to %s\n", info.Path)
+						return err
+					})
+				},
+			},
+			{
+				Name:  "backups",
+				Usage: "manage backups made with the backup command",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "list backups, newest first",
+						Flags: []cli.Flag{
+							outputFlag(),
+						},
+						Action: func(c *cli.Context) error {
+							b, err := startBackend(c)
+							if err != nil {
+								return err
+							}
+							backups, err := b.ListBackups()
+							if err != nil {
+								return err
+							}
+							return finish(c, backups, nil, func(w io.Writer) error {
+								return printBackups(w, backups)
+							})
+						},
+					},
+					{
+						Name:      "restore-to",
+						Usage:     "extract a backup into a folder laid out like the kobo, ready for use with --mount",
+						ArgsUsage: "<dir>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "name",
+								Usage: "backup to restore. defaults to the newest",
+							},
+							outputFlag(),
+						},
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 1 {
+								return withExitCode(exitUsage, fmt.Errorf("expected a folder to restore the backup into"))
+							}
+							b, err := startBackend(c)
+							if err != nil {
+								return err
+							}
+							name := c.String("name")
+							if name == "" {
+								backups, err := b.ListBackups()
+								if err != nil {
+									return err
+								}
+								if len(backups) == 0 {
+									return fmt.Errorf("there are no backups to restore")
+								}
+								name = backups[0].Name
+							}
+							dir := c.Args().First()
+							if err := b.RestoreBackup(name, dir); err != nil {
+								return err
+							}
+							return finish(c, restoreResult{Name: name, Dir: dir}, nil, func(w io.Writer) error {
+								_, err := fmt.Fprintf(w, "Restored %s to %s\n", name, dir)
+								return err
+							})
+						},
+					},
+				},
+			},
+			{
+				Name:  "doctor",
+				Usage: "check for anything that would stop a sync from working",
+				Flags: []cli.Flag{
+					outputFlag(),
+				},
+				Action: func(c *cli.Context) error {
+					report := backend.RunDoctor(backend.DoctorOptions{
+						Portable: isPortable,
+						DbPath:   c.String("db"),
+						MntPath:  c.String("mount"),
+						Device:   c.String("device"),
+					}, logger)
+					var err error
+					if report.Failed() {
+						err = fmt.Errorf("doctor found problems that will stop a sync from working")
+					}
+					return finish(c, report, err, func(w io.Writer) error {
+						return printDoctorReport(w, report)
+					})
+				},
+			},
+			{
+				Name:  "stats",
+				Usage: "show reading time, finished books and highlight counts from your kobo",
+				Flags: []cli.Flag{
+					outputFlag(),
+				},
+				Action: func(c *cli.Context) error {
+					b, err := startBackend(c)
+					if err != nil {
+						return err
+					}
+					if err := selectKobo(c, b); err != nil {
+						return err
+					}
+					stats, err := b.GetReadingStats()
+					if err != nil {
+						return err
+					}
+					return finish(c, stats, nil, func(w io.Writer) error {
+						return printStats(w, stats)
+					})
+				},
+			},
+			{
+				Name:  "export",
+				Usage: "write every highlight on your kobo to a file without syncing anything",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: fmt.Sprintf("format of the export (%s, %s or %s)", backend.ExportFormatCSV, backend.ExportFormatJSON, backend.ExportFormatNDJSON),
+						Value: backend.ExportFormatCSV,
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "file to write the export to. defaults to stdout, which can't be used with --output json",
+						Value: "-",
+					},
+					outputFlag(),
+				},
 				Action: func(c *cli.Context) error {
-					ctx := context.Background()
-					b, err := backend.StartBackend(&ctx, version, isPortable, logger)
+					if c.String("out") == "-" && outputFormat(c) == outputJSON {
+						return withExitCode(exitUsage, fmt.Errorf("--output json needs the export to be written to a file with --out"))
+					}
+					if err := backend.ValidateExportFormat(c.String("format")); err != nil {
+						return withExitCode(exitUsage, err)
+					}
+					b, err := startBackend(c)
+					if err != nil {
+						return err
+					}
+					if err := selectKobo(c, b); err != nil {
+						return err
+					}
+					records, err := b.ExportHighlights()
 					if err != nil {
 						return err
 					}
-					if b.Settings.NotadoToken == "" {
-						return fmt.Errorf("no notado token was configured. please set this up using the gui as the cli does not support this yet")
+					if err := writeExport(c, records); err != nil {
+						return err
+					}
+					if c.String("out") == "-" {
+						return nil
+					}
+					summary := exportSummary{Format: c.String("format"), Path: c.String("out"), Count: len(records)}
+					return finish(c, summary, nil, func(w io.Writer) error {
+						_, err := fmt.Fprintf(w, "Exported %d highlights to %s\n", summary.Count, summary.Path)
+						return err
+					})
+				},
+			},
+			{
+				Name:  "config",
+				Usage: "view and change settings without the gui",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "set-token",
+						Usage: fmt.Sprintf("save an access token, read from $%s, $%s or stdin so that it stays out of your shell history", notadoTokenEnv, readwiseTokenEnv),
+						Flags: []cli.Flag{
+							outputFlag(),
+							&cli.StringFlag{
+								Name:  "destination",
+								Usage: fmt.Sprintf("destination the token is for. one of %s or %s", backend.NotadoDestinationName, backend.ReadwiseDestinationName),
+								Value: backend.NotadoDestinationName,
+							},
+						},
+						Action: func(c *cli.Context) error {
+							destination := c.String("destination")
+							if _, ok := tokenEnvs[destination]; !ok {
+								return withExitCode(exitUsage, fmt.Errorf("%q doesn't take an access token. use %s or %s", destination, backend.NotadoDestinationName, backend.ReadwiseDestinationName))
+							}
+							settings, err := backend.LoadSettings(isPortable, logger)
+							if err != nil {
+								return err
+							}
+							token, err := readToken(c.App.Reader, c.App.ErrWriter, destination)
+							if err != nil {
+								return withExitCode(exitNoToken, err)
+							}
+							save := settings.SaveToken
+							if destination == backend.ReadwiseDestinationName {
+								save = settings.SaveReadwiseToken
+							}
+							if err := save(token); err != nil {
+								return err
+							}
+							return finish(c, settingResult{Setting: destination + "-token"}, nil, func(w io.Writer) error {
+								_, err := fmt.Fprintf(w, "Saved %s token\n", destination)
+								return err
+							})
+						},
+					},
+					{
+						Name:  "show",
+						Usage: "print your settings with access tokens redacted",
+						Flags: []cli.Flag{
+							outputFlag(),
+						},
+						Action: func(c *cli.Context) error {
+							settings, err := backend.LoadSettings(isPortable, logger)
+							if err != nil {
+								return err
+							}
+							redacted := settings.Redacted()
+							return finish(c, redacted, nil, func(w io.Writer) error {
+								return printSettings(w, redacted)
+							})
+						},
+					},
+					{
+						Name:      "set",
+						Usage:     fmt.Sprintf("change a setting. one of %v", backend.SettingOptions),
+						ArgsUsage: "<setting> <value>",
+						Flags: []cli.Flag{
+							outputFlag(),
+						},
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 2 {
+								return withExitCode(exitUsage, fmt.Errorf("expected a setting and a value, such as `config set upload-store-highlights false`"))
+							}
+							settings, err := backend.LoadSettings(isPortable, logger)
+							if err != nil {
+								return err
+							}
+							if err := settings.SetOption(c.Args().Get(0), c.Args().Get(1)); err != nil {
+								return withExitCode(exitUsage, err)
+							}
+							return finish(c, settingResult{Setting: c.Args().Get(0)}, nil, func(w io.Writer) error {
+								_, err := fmt.Fprintf(w, "Saved %s\n", c.Args().Get(0))
+								return err
+							})
+						},
+					},
+					{
+						Name:  "path",
+						Usage: "print where the settings file is stored",
+						Flags: []cli.Flag{
+							outputFlag(),
+						},
+						Action: func(c *cli.Context) error {
+							settings, err := backend.LoadSettings(isPortable, logger)
+							if err != nil {
+								return err
+							}
+							return finish(c, pathResult{Path: settings.Path()}, nil, func(w io.Writer) error {
+								_, err := fmt.Fprintln(w, settings.Path())
+								return err
+							})
+						},
+					},
+				},
+			},
+			{
+				Name:  "orphaned",
+				Usage: "list highlights that were synced but have since been deleted on your kobo, so that you can clean them up",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "forget",
+						Usage: "stop reporting these highlights once you have cleaned them up",
+					},
+					outputFlag(),
+				},
+				Action: func(c *cli.Context) error {
+					b, err := startBackend(c)
+					if err != nil {
+						return err
 					}
-					kobos := b.DetectKobos()
-					if len(kobos) == 0 {
-						return fmt.Errorf("no kobo was found. have you plugged one in and accepted the connection request?")
+					if err := selectKobo(c, b); err != nil {
+						return err
 					}
-					if len(kobos) > 1 {
-						return fmt.Errorf("cli only supports one connected kobo at a time")
+					var orphans []backend.OrphanedHighlight
+					if c.Bool("forget") {
+						orphans, err = b.ForgetOrphanedHighlights()
+					} else {
+						orphans, err = b.ListOrphanedHighlights()
 					}
-					if err := b.SelectKobo(kobos[0].MntPath); err != nil {
-						return fmt.Errorf("an error occurred trying to connect to the kobo at %s", kobos[0].MntPath)
+					if err != nil {
+						return err
 					}
-					num, err := b.ForwardToNotado()
+					return finish(c, orphans, nil, func(w io.Writer) error {
+						return printOrphans(w, orphans, c.Bool("forget"))
+					})
+				},
+			},
+			{
+				Name:  "reset-state",
+				Usage: "forget which highlights have already been synced so that the next sync sends everything",
+				Flags: []cli.Flag{
+					outputFlag(),
+				},
+				Action: func(c *cli.Context) error {
+					b, err := startBackend(c)
 					if err != nil {
 						return err
 					}
-					logger.Info("Successfully synced highlights to Notado",
-						slog.Int("count", num),
-					)
-					return nil
+					if err := b.ResetSyncState(); err != nil {
+						return err
+					}
+					logger.Info("Successfully reset sync state")
+					return finish(c, nil, nil, nil)
 				},
 			},
 		},
@@ -80,9 +748,13 @@ func Invoke(isPortable bool, version string, logger *slog.Logger) {
 		args = append(args, v)
 	}
 
-	err := app.Run(args)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := app.RunContext(ctx, args)
+	stop()
+	// Errors from commands exit through ExitErrHandler so anything left over is from
+	// urfave/cli rejecting the arguments
 	if err != nil {
 		logger.Error(err.Error())
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 }
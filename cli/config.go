@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/marcus-crane/october/backend"
+)
+
+const (
+	notadoTokenEnv   = "NOTADO_TOKEN"
+	readwiseTokenEnv = "READWISE_TOKEN"
+)
+
+// tokenEnvs are the environment variables that set-token reads each destination's token from
+var tokenEnvs = map[string]string{
+	backend.NotadoDestinationName:   notadoTokenEnv,
+	backend.ReadwiseDestinationName: readwiseTokenEnv,
+}
+
+// readToken takes the token for destination from the environment if it is set and otherwise
+// reads the first line of r, prompting on w when a person is typing it in
+func readToken(r io.Reader, w io.Writer, destination string) (string, error) {
+	env := tokenEnvs[destination]
+	if token := strings.TrimSpace(os.Getenv(env)); token != "" {
+		return token, nil
+	}
+	if f, ok := r.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			fmt.Fprintf(w, "Paste your %s access token and press enter: ", destination)
+		}
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read token: %w", err)
+	}
+	token := strings.TrimSpace(line)
+	if token == "" {
+		return "", fmt.Errorf("no token was provided. pipe it in on stdin or set $%s", env)
+	}
+	return token, nil
+}
+
+func printSettings(w io.Writer, settings backend.Settings) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "path\t%s\n", settings.Path())
+	fmt.Fprintf(tw, "notado token\t%s\n", settings.NotadoToken)
+	fmt.Fprintf(tw, "notado endpoint\t%s\n", settings.NotadoEndpoint)
+	fmt.Fprintf(tw, "upload store highlights\t%t\n", settings.UploadStoreHighlights)
+	fmt.Fprintf(tw, "destinations\t%s\n", strings.Join(settings.Destinations, ","))
+	fmt.Fprintf(tw, "markdown vault path\t%s\n", settings.MarkdownVaultPath)
+	fmt.Fprintf(tw, "readwise token\t%s\n", settings.ReadwiseToken)
+	fmt.Fprintf(tw, "backup before sync\t%t\n", settings.BackupBeforeSync)
+	fmt.Fprintf(tw, "backup retention\t%d\n", settings.BackupRetention)
+	fmt.Fprintf(tw, "bookmark types\t%v\n", settings.BookmarkTypes)
+	fmt.Fprintf(tw, "export page markers\t%t\n", settings.ExportPageMarkers)
+	fmt.Fprintf(tw, "include hidden highlights\t%t\n", settings.IncludeHiddenHighlights)
+	var colourTags []string
+	for _, colour := range backend.HighlightColours {
+		if tag := settings.HighlightColourTags[colour]; tag != "" {
+			colourTags = append(colourTags, fmt.Sprintf("%s=%s", colour, tag))
+		}
+	}
+	fmt.Fprintf(tw, "highlight colour tags\t%s\n", strings.Join(colourTags, ","))
+	fmt.Fprintf(tw, "context length\t%d\n", settings.ContextLength)
+	return tw.Flush()
+}
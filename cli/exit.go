@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"errors"
+
+	"github.com/marcus-crane/october/backend"
+)
+
+// Exit codes are part of the cli's interface so that scripts can react to why a command
+// failed. They must not be renumbered once released.
+const (
+	exitOK           = 0
+	exitFailure      = 1
+	exitUsage        = 2
+	exitNoDevice     = 3
+	exitNoToken      = 4
+	exitNoHighlights = 5
+	exitNetwork      = 6
+	exitAuth         = 7
+	exitPartial      = 8
+)
+
+const exitCodesHelp = `EXIT CODES:
+   0  success
+   1  an error not covered below
+   2  the command was used incorrectly
+   3  no kobo was found, or it couldn't be opened
+   4  a destination is enabled but has no access token
+   5  the kobo has no highlights to sync
+   6  a destination couldn't be reached or failed on its end
+   7  a destination rejected the access token
+   8  some highlights, destinations or devices synced but others failed`
+
+// cliError tags an error with the exit code it should produce when the cause can't be
+// worked out from the error itself
+type cliError struct {
+	code int
+	err  error
+}
+
+func (e *cliError) Error() string {
+	return e.err.Error()
+}
+
+func (e *cliError) Unwrap() error {
+	return e.err
+}
+
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &cliError{code: code, err: err}
+}
+
+// exitCode picks the documented exit code for err
+func exitCode(err error) int {
+	var tagged *cliError
+	var noHighlights *backend.NoHighlightsError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &tagged):
+		return tagged.code
+	case errors.As(err, &noHighlights):
+		return exitNoHighlights
+	case backend.IsMissingTokenError(err):
+		return exitNoToken
+	case backend.IsAuthError(err):
+		return exitAuth
+	case backend.IsNetworkError(err):
+		return exitNetwork
+	}
+	return exitFailure
+}
+
+// syncExitCode reports a failed sync as partial when anything at all made it to a destination
+func syncExitCode(results []backend.SyncResult, err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, result := range results {
+		if result.Err == nil || result.Sent > 0 {
+			return withExitCode(exitPartial, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/marcus-crane/october/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"success", nil, exitOK},
+		{"unknown failure", errors.New("something broke"), exitFailure},
+		{"tagged", withExitCode(exitUsage, errors.New("bad flag")), exitUsage},
+		{"no device", withExitCode(exitNoDevice, errors.New("no kobo was found")), exitNoDevice},
+		{"no token", &backend.MissingTokenError{Destination: "readwise"}, exitNoToken},
+		{"no highlights", &backend.NoHighlightsError{Message: "nothing to sync"}, exitNoHighlights},
+		{"network", &backend.NotadoServerError{StatusCode: 502}, exitNetwork},
+		{"notado auth", &backend.NotadoAuthError{StatusCode: 401}, exitAuth},
+		{"readwise auth", &backend.ReadwiseAuthError{StatusCode: 401}, exitAuth},
+		{"partial", withExitCode(exitPartial, errors.New("1 of 2 kobos failed to sync")), exitPartial},
+		{"wrapped", fmt.Errorf("2 of 2 kobos failed to sync: %w", &backend.NotadoAuthError{StatusCode: 403}), exitAuth},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.code, exitCode(tc.err))
+		})
+	}
+}
+
+func TestSyncExitCode(t *testing.T) {
+	authErr := &backend.NotadoAuthError{StatusCode: 401}
+	networkErr := &backend.NotadoServerError{StatusCode: 500}
+	cases := []struct {
+		name    string
+		results []backend.SyncResult
+		err     error
+		code    int
+	}{
+		{"success", []backend.SyncResult{{Destination: "notado", Sent: 3}}, nil, exitOK},
+		{"one destination failed outright", []backend.SyncResult{{Destination: "notado", Err: authErr}}, authErr, exitAuth},
+		{"every destination failed outright", []backend.SyncResult{
+			{Destination: "notado", Err: networkErr},
+			{Destination: "readwise", Err: networkErr},
+		}, networkErr, exitNetwork},
+		{"one of two destinations failed", []backend.SyncResult{
+			{Destination: "notado", Err: authErr},
+			{Destination: "markdown", Sent: 4},
+		}, authErr, exitPartial},
+		{"some batches made it", []backend.SyncResult{{Destination: "notado", Sent: 2, Err: networkErr}}, networkErr, exitPartial},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.code, exitCode(syncExitCode(tc.results, tc.err)))
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTerminalLog(t *testing.T) {
+	var file, stderr bytes.Buffer
+	level := &slog.LevelVar{}
+	logger := withTerminalLog(slog.New(slog.NewTextHandler(&file, &slog.HandlerOptions{Level: slog.LevelDebug})), &stderr, level)
+
+	logger.Debug("Only in the log file")
+	logger.Info("Syncing kobo", slog.String("serial", "N418"))
+	logger.With(slog.String("destination", "notado")).Warn("Retrying batch")
+	logger.Error("Failed to sync", slog.String("error", "timeout"))
+
+	assert.Equal(t, "Syncing kobo serial=N418\nwarning: Retrying batch destination=notado\nerror: Failed to sync error=timeout\n", stderr.String())
+	for _, message := range []string{"Only in the log file", "Syncing kobo", "Retrying batch", "Failed to sync"} {
+		assert.Contains(t, file.String(), message)
+	}
+
+	// Raising the terminal level, as --quiet does, leaves the log file untouched
+	stderr.Reset()
+	level.Set(slog.LevelError)
+	logger.Info("Synced kobo")
+	assert.Empty(t, stderr.String())
+	assert.Contains(t, file.String(), "Synced kobo")
+}
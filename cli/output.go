@@ -0,0 +1,350 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/marcus-crane/october/backend"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	previewContentWidth = 60
+	previewChapterWidth = 24
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// commandResult is printed by every command in json mode so that scripts can rely on the
+// same shape no matter which command ran or how it failed
+type commandResult struct {
+	Command  string `json:"command"`
+	OK       bool   `json:"ok"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+	Result   any    `json:"result,omitempty"`
+}
+
+// reportedError marks an error whose result has already been printed so that it isn't
+// printed a second time on the way out
+type reportedError struct {
+	error
+}
+
+func (e *reportedError) Unwrap() error {
+	return e.error
+}
+
+// outputFlag is added to each command as well as globally so that --output can go on
+// either side of the command name
+func outputFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "output",
+		Usage: fmt.Sprintf("format of the results (%s or %s)", outputText, outputJSON),
+		Value: outputText,
+	}
+}
+
+// outputFormat finds the closest --output that was actually set since a command's own
+// default would otherwise hide one given globally
+func outputFormat(c *cli.Context) string {
+	for _, ctx := range c.Lineage() {
+		if slices.Contains(ctx.LocalFlagNames(), "output") {
+			return ctx.String("output")
+		}
+	}
+	return outputText
+}
+
+func newCommandResult(c *cli.Context, result any, err error) commandResult {
+	// The root command is the app itself so it is left out of the name
+	var names []string
+	for _, ctx := range c.Lineage() {
+		if ctx.Command != nil && ctx.Command.Name != "" && ctx.Command.Name != c.App.Name {
+			names = append([]string{ctx.Command.Name}, names...)
+		}
+	}
+	out := commandResult{Command: strings.Join(names, " "), OK: err == nil, ExitCode: exitCode(err), Result: result}
+	if err != nil {
+		out.Error = err.Error()
+	}
+	return out
+}
+
+func writeJSON(w io.Writer, v any, indent bool) error {
+	enc := json.NewEncoder(w)
+	if indent {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(v)
+}
+
+// finish prints the outcome of a command, as the json envelope or by calling text, and then
+// passes err along so that it decides the exit code. text may be nil when a command has
+// nothing to say beyond what it has logged.
+func finish(c *cli.Context, result any, err error, text func(w io.Writer) error) error {
+	switch format := outputFormat(c); format {
+	case outputJSON:
+		if writeErr := writeJSON(c.App.Writer, newCommandResult(c, result, err), true); writeErr != nil {
+			return errors.Join(err, writeErr)
+		}
+		if err != nil {
+			return &reportedError{err}
+		}
+		return nil
+	case outputText:
+		if text != nil {
+			if textErr := text(c.App.Writer); textErr != nil {
+				return errors.Join(err, textErr)
+			}
+		}
+		return err
+	default:
+		return withExitCode(exitUsage, fmt.Errorf("unknown output format %q. expected %s or %s", format, outputText, outputJSON))
+	}
+}
+
+func printPreview(w io.Writer, preview backend.SyncPreview) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, book := range preview.Books {
+		fmt.Fprintf(tw, "%s\n", book.Title)
+		fmt.Fprintf(tw, "  BATCH\tCHAPTER\tAT\tCHUNK\tCREATED\tTAGS\tCONTENT\n")
+		for _, highlight := range book.Highlights {
+			at := "?"
+			if highlight.BookProgress >= 0 {
+				at = fmt.Sprintf("%.0f%%", highlight.BookProgress)
+			}
+			fmt.Fprintf(tw, "  %d\t%s\t%s\t%d/%d\t%s\t%s\t%s\n",
+				highlight.Batch,
+				backend.TruncateText(highlight.Chapter, previewChapterWidth),
+				at,
+				highlight.Chunk,
+				highlight.ChunkCount,
+				highlight.Created,
+				strings.Join(highlight.Tags, ","),
+				backend.TruncateText(highlight.Content, previewContentWidth),
+			)
+		}
+		fmt.Fprintln(tw)
+	}
+	fmt.Fprintf(tw, "%d notes across %d books would be sent in %d batches\n", preview.NoteCount, len(preview.Books), preview.BatchCount)
+	return tw.Flush()
+}
+
+func printDevices(w io.Writer, kobos []backend.Kobo) error {
+	if len(kobos) == 0 {
+		fmt.Fprintln(w, "No kobos were found. Have you plugged one in and accepted the connection request?")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "NAME\tSTORAGE\tPPI\tMOUNT\tDATABASE\tSERIAL\tFIRMWARE\tDEVICE ID\n")
+	for _, kobo := range kobos {
+		name := kobo.Name
+		if name == "" {
+			name = "Unknown Kobo"
+		}
+		fmt.Fprintf(tw, "%s\t%dGB\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			name,
+			kobo.Storage,
+			kobo.DisplayPPI,
+			kobo.MntPath,
+			kobo.DbPath,
+			kobo.Serial,
+			kobo.FirmwareVersion,
+			kobo.DeviceID,
+		)
+	}
+	return tw.Flush()
+}
+
+// deviceSummary is the outcome of syncing a single kobo
+type deviceSummary struct {
+	Kobo         backend.Kobo         `json:"device"`
+	Destinations []backend.SyncResult `json:"destinations"`
+	Error        string               `json:"error,omitempty"`
+	Err          error                `json:"-"`
+}
+
+type allDevicesResult struct {
+	Devices []deviceSummary `json:"devices"`
+}
+
+func printDeviceSummaries(w io.Writer, summaries []deviceSummary) error {
+	for _, summary := range summaries {
+		name := summary.Kobo.Name
+		if name == "" {
+			name = "Unknown Kobo"
+		}
+		fmt.Fprintf(w, "%s (%s) at %s\n", name, summary.Kobo.Serial, summary.Kobo.MntPath)
+		for _, result := range summary.Destinations {
+			if result.Err != nil {
+				fmt.Fprintf(w, "  %s: failed after sending %d highlights\n", result.Destination, result.Sent)
+				continue
+			}
+			fmt.Fprintf(w, "  %s: sent %d highlights\n", result.Destination, result.Sent)
+		}
+		for _, result := range summary.Destinations {
+			if len(result.Orphaned) > 0 {
+				fmt.Fprintf(w, "  %s: %d highlights sent before have been deleted on the kobo. see `noctober cli orphaned`\n", result.Destination, len(result.Orphaned))
+			}
+		}
+		if summary.Err != nil {
+			fmt.Fprintf(w, "  error: %s\n", summary.Err)
+		}
+	}
+	return nil
+}
+
+func printOrphans(w io.Writer, orphans []backend.OrphanedHighlight, forgotten bool) error {
+	if len(orphans) == 0 {
+		fmt.Fprintln(w, "Every highlight that has been synced is still on your kobo")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "DESTINATION\tREASON\tSYNCED\tTEXT\n")
+	for _, orphan := range orphans {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", orphan.Destination, orphan.Reason, orphan.SyncedAt, backend.TruncateText(orphan.Text, previewContentWidth))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if forgotten {
+		fmt.Fprintf(w, "Forgot %d highlights. They won't be reported again.\n", len(orphans))
+	}
+	return nil
+}
+
+func printBackups(w io.Writer, backups []backend.BackupInfo) error {
+	if len(backups) == 0 {
+		fmt.Fprintln(w, "No backups have been made yet")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "NAME\tDEVICE\tCREATED\tSIZE\n")
+	for _, backup := range backups {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", backup.Name, backup.Device, backup.CreatedAt, formatSize(backup.Size))
+	}
+	return tw.Flush()
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1fMB", float64(size)/1024/1024)
+	case size >= 1024:
+		return fmt.Sprintf("%.1fKB", float64(size)/1024)
+	}
+	return fmt.Sprintf("%dB", size)
+}
+
+func printDoctorReport(w io.Writer, report backend.DoctorReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, check := range report.Checks {
+		fmt.Fprintf(tw, "[%s]\t%s\t%s\n", check.Status, check.Name, check.Detail)
+	}
+	return tw.Flush()
+}
+
+func printStats(w io.Writer, stats backend.ReadingStats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Total reading time\t%s\n", formatDuration(stats.TotalReadingTime))
+	fmt.Fprintf(tw, "Average session\t%s\n", formatDuration(stats.AverageSession))
+	fmt.Fprintf(tw, "Books finished\t%d\n", stats.BooksFinished)
+	if len(stats.FinishedByYear) > 0 {
+		fmt.Fprintf(tw, "\nFINISHED\tBOOKS\n")
+		for _, year := range stats.FinishedByYear {
+			fmt.Fprintf(tw, "%s\t%d\n", year.Period, year.Books)
+			for _, month := range stats.FinishedByMonth {
+				if strings.HasPrefix(month.Period, year.Period+"-") {
+					fmt.Fprintf(tw, "  %s\t%d\n", month.Period, month.Books)
+				}
+			}
+		}
+	}
+	if len(stats.CurrentlyReading) > 0 {
+		fmt.Fprintf(tw, "\nCURRENTLY READING\tPROGRESS\tTIME SPENT\tLAST READ\n")
+		for _, book := range stats.CurrentlyReading {
+			fmt.Fprintf(tw, "%s\t%d%%\t%s\t%s\n", backend.TruncateText(book.Title, previewContentWidth), book.PercentRead, formatDuration(book.TimeSpent), book.LastRead)
+		}
+	}
+	if len(stats.HighlightsPerBook) > 0 {
+		fmt.Fprintf(tw, "\nBOOK\tHIGHLIGHTS\n")
+		for _, book := range stats.HighlightsPerBook {
+			fmt.Fprintf(tw, "%s\t%d\n", backend.TruncateText(book.Title, previewContentWidth), book.Highlights)
+		}
+	}
+	return tw.Flush()
+}
+
+// formatDuration shows a number of seconds in hours and minutes, which is as precise as
+// reading time needs to be
+func formatDuration(seconds int) string {
+	minutes := seconds / 60
+	if minutes < 60 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh %dm", minutes/60, minutes%60)
+}
+
+type restoreResult struct {
+	Name string `json:"name"`
+	Dir  string `json:"dir"`
+}
+
+type settingResult struct {
+	Setting string `json:"setting"`
+}
+
+type pathResult struct {
+	Path string `json:"path"`
+}
+
+// exportSummary describes a finished export in json mode, where the records themselves
+// have to go to a file so that they don't get mixed up with the result
+type exportSummary struct {
+	Format string `json:"format"`
+	Path   string `json:"path"`
+	Count  int    `json:"count"`
+}
+
+// writeExport writes records to the file named by --out, or stdout when it is -. The file is
+// only replaced once the export has been written in full.
+func writeExport(c *cli.Context, records []backend.ExportRecord) error {
+	out := c.String("out")
+	format := c.String("format")
+	if out == "-" {
+		return backend.WriteExport(c.App.Writer, records, format)
+	}
+	if err := backend.ValidateExportFormat(format); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(out), "."+filepath.Base(out)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	err = backend.WriteExport(f, records, format)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	if err := os.Rename(f.Name(), out); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	return nil
+}
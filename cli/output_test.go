@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/marcus-crane/october/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+)
+
+// runJSONCommand runs "config show" with --output json, finishing with result and err, and
+// returns what was printed
+func runJSONCommand(t *testing.T, result any, err error) (map[string]any, error) {
+	t.Helper()
+	var out bytes.Buffer
+	app := &cli.App{
+		Name:   "noctober",
+		Writer: &out,
+		Flags:  []cli.Flag{outputFlag()},
+		Commands: []*cli.Command{{
+			Name: "config",
+			Subcommands: []*cli.Command{{
+				Name:  "show",
+				Flags: []cli.Flag{outputFlag()},
+				Action: func(c *cli.Context) error {
+					return finish(c, result, err, nil)
+				},
+			}},
+		}},
+	}
+	runErr := app.Run([]string{"noctober", "config", "show", "--output", "json"})
+	var envelope map[string]any
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &envelope))
+	return envelope, runErr
+}
+
+func TestCommandResult_JSON(t *testing.T) {
+	cases := []struct {
+		name     string
+		result   any
+		err      error
+		expected map[string]any
+	}{
+		{
+			name:   "success",
+			result: pathResult{Path: "/data/october/config.json"},
+			expected: map[string]any{
+				"command":   "config show",
+				"ok":        true,
+				"exit_code": float64(exitOK),
+				"result":    map[string]any{"path": "/data/october/config.json"},
+			},
+		},
+		{
+			name: "failure",
+			err:  &backend.MissingTokenError{Destination: "notado"},
+			expected: map[string]any{
+				"command":   "config show",
+				"ok":        false,
+				"exit_code": float64(exitNoToken),
+				"error":     "no notado token was configured",
+			},
+		},
+		{
+			name:   "partial failure keeps its result",
+			result: settingResult{Setting: "destinations"},
+			err:    withExitCode(exitPartial, errors.New("1 of 2 kobos failed to sync")),
+			expected: map[string]any{
+				"command":   "config show",
+				"ok":        false,
+				"exit_code": float64(exitPartial),
+				"error":     "1 of 2 kobos failed to sync",
+				"result":    map[string]any{"setting": "destinations"},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			envelope, err := runJSONCommand(t, tc.result, tc.err)
+			assert.Equal(t, tc.expected, envelope)
+			if tc.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			// The error is still returned for its exit code but isn't printed again
+			var reported *reportedError
+			assert.ErrorAs(t, err, &reported)
+			assert.Equal(t, tc.expected["exit_code"], float64(exitCode(err)))
+		})
+	}
+}
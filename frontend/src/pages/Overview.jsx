@@ -5,7 +5,7 @@ import { CountDeviceBookmarks } from "../../wailsjs/go/backend/Kobo";
 import {
   GetSettings,
   GetSelectedKobo,
-  ForwardToNotado,
+  SyncHighlights,
 } from "../../wailsjs/go/backend/Backend";
 
 export default function Overview(props) {
@@ -44,12 +44,25 @@ export default function Overview(props) {
 
   function syncWithNotado() {
     const toastId = toast.loading("Preparing your highlights...");
-    ForwardToNotado()
+    SyncHighlights()
       .then((res) => {
-        if (typeof res == "number") {
-          toast.success(`Successfully forwarded ${res} highlights to Notado`, {
+        if (Array.isArray(res)) {
+          const summary = res
+            .map((result) => `${result.sent} to ${result.destination}`)
+            .join(", ");
+          toast.success(`Successfully forwarded highlights: ${summary}`, {
             id: toastId,
           });
+          const orphaned = res.reduce(
+            (count, result) => count + (result.orphaned || []).length,
+            0,
+          );
+          if (orphaned > 0) {
+            toast(
+              `${orphaned} highlights that were synced before have since been deleted on your Kobo. You may want to remove them from your destinations too.`,
+              { duration: 8000 },
+            );
+          }
         } else {
           toast.error(
             `There was a problem sending your highlights: ${res.message}`,
@@ -58,14 +71,9 @@ export default function Overview(props) {
         }
       })
       .catch((err) => {
-        if (err.includes("401")) {
-          toast.error(
-            "Received 401 Unauthorised from Notado. Is your access token correct?",
-            { id: toastId },
-          );
-        } else {
-          toast.error(err, { id: toastId, duration: 8000 });
-        }
+        // Errors from the backend already name the destination that failed and what to do
+        // about a missing or rejected access token
+        toast.error(err, { id: toastId, duration: 8000 });
       });
   }
 
@@ -7,16 +7,36 @@ import {
   NavigateExplorerToLogLocation,
   FormatSystemDetails,
   GetPlainSystemDetails,
+  ListDestinations,
+  PromptForMarkdownVaultPath,
 } from "../../wailsjs/go/backend/Backend";
 import {
   SaveToken,
+  SaveDestinations,
+  SaveReadwiseToken,
+  SaveBookmarkTypes,
+  SaveExportPageMarkers,
+  SaveIncludeHiddenHighlights,
+  SaveHighlightColourTags,
+  SaveContextLength,
 } from "../../wailsjs/go/backend/Settings";
 
+const bookmarkTypes = ["highlight", "note", "markup"];
+const highlightColours = ["yellow", "pink", "blue", "green"];
+
 export default function Settings() {
   const [loaded, setLoadState] = useState(false);
   const [token, setToken] = useState("");
   const [storeHighlights, setStoreHighlights] = useState(false);
   const [tokenInput, setTokenInput] = useState("");
+  const [readwiseTokenInput, setReadwiseTokenInput] = useState("");
+  const [destinations, setDestinations] = useState([]);
+  const [enabledTypes, setEnabledTypes] = useState([]);
+  const [exportPageMarkers, setExportPageMarkers] = useState(false);
+  const [includeHidden, setIncludeHidden] = useState(false);
+  const [colourTags, setColourTags] = useState({});
+  const [contextLength, setContextLength] = useState(0);
+  const [vaultPath, setVaultPath] = useState("");
   const [systemDetails, setSystemDetails] = useState(
     "Fetching system details...",
   );
@@ -27,7 +47,15 @@ export default function Settings() {
       setToken(settings.notado_token);
       setTokenInput(settings.notado_token);
       setStoreHighlights(settings.upload_store_highlights);
+      setReadwiseTokenInput(settings.readwise_token || "");
+      setEnabledTypes(settings.bookmark_types || []);
+      setExportPageMarkers(settings.export_page_markers);
+      setIncludeHidden(settings.include_hidden_highlights);
+      setColourTags(settings.highlight_colour_tags || {});
+      setContextLength(settings.context_length || 0);
+      setVaultPath(settings.markdown_vault_path || "");
     });
+    ListDestinations().then((destinations) => setDestinations(destinations));
     GetPlainSystemDetails().then((details) => setSystemDetails(details));
   }, [loaded]);
 
@@ -37,6 +65,79 @@ export default function Settings() {
     toast.success("Your changes have been saved");
   }
 
+  function saveReadwiseToken() {
+    SaveReadwiseToken(readwiseTokenInput);
+    toast.success("Your changes have been saved");
+  }
+
+  function toggleDestination(name) {
+    const updated = destinations.map((destination) =>
+      destination.name === name
+        ? { ...destination, enabled: !destination.enabled }
+        : destination,
+    );
+    const enabled = updated.filter((d) => d.enabled).map((d) => d.name);
+    SaveDestinations(enabled)
+      .then(() => {
+        setDestinations(updated);
+        toast.success("Your changes have been saved");
+      })
+      .catch((err) => toast.error(err));
+  }
+
+  function chooseVaultPath() {
+    PromptForMarkdownVaultPath()
+      .then(() => GetSettings())
+      .then((settings) => {
+        setVaultPath(settings.markdown_vault_path || "");
+        toast.success("Your changes have been saved");
+      })
+      .catch((err) => {
+        // Closing the dialog without picking a folder leaves the vault as it was
+        if (err !== "canceled selection") {
+          toast.error(err);
+        }
+      });
+  }
+
+  function toggleBookmarkType(type) {
+    const updated = enabledTypes.includes(type)
+      ? enabledTypes.filter((t) => t !== type)
+      : [...enabledTypes, type];
+    SaveBookmarkTypes(updated)
+      .then(() => {
+        setEnabledTypes(updated);
+        toast.success("Your changes have been saved");
+      })
+      .catch((err) => toast.error(err));
+  }
+
+  function toggleExportPageMarkers() {
+    SaveExportPageMarkers(!exportPageMarkers).then(() => {
+      setExportPageMarkers(!exportPageMarkers);
+      toast.success("Your changes have been saved");
+    });
+  }
+
+  function toggleIncludeHidden() {
+    SaveIncludeHiddenHighlights(!includeHidden).then(() => {
+      setIncludeHidden(!includeHidden);
+      toast.success("Your changes have been saved");
+    });
+  }
+
+  function saveColourTags() {
+    SaveHighlightColourTags(colourTags)
+      .then(() => toast.success("Your changes have been saved"))
+      .catch((err) => toast.error(err));
+  }
+
+  function saveContextLength() {
+    SaveContextLength(Number(contextLength))
+      .then(() => toast.success("Your changes have been saved"))
+      .catch((err) => toast.error(err));
+  }
+
   return (
     <div className="min-h-screen bg-gray-100 dark:bg-gray-800 flex flex-col">
       <Navbar />
@@ -92,6 +193,283 @@ export default function Settings() {
               </form>
             </div>
           </div>
+          <div className="bg-white dark:bg-slate-700 shadow sm:rounded-lg">
+            <div className="px-4 py-5 sm:p-6">
+              <h3 className="text-lg leading-6 font-medium text-gray-900 dark:text-gray-300">
+                Set your Readwise access token
+              </h3>
+              <div className="mt-2 max-w-xl text-sm text-gray-500 dark:text-gray-400">
+                <p>
+                  You can find your access token at{" "}
+                  <button
+                    className="text-gray-600 dark:text-gray-400 underline"
+                    onClick={() =>
+                      BrowserOpenURL("https://readwise.io/access_token")
+                    }
+                  >
+                    https://readwise.io/access_token
+                  </button>
+                </p>
+              </div>
+              <form
+                onSubmit={(e) => e.preventDefault()}
+                className="sm:flex flex-col"
+              >
+                <div className="w-full mt-4 sm:flex sm:items-center">
+                  <input
+                    onChange={(e) => setReadwiseTokenInput(e.target.value)}
+                    type="text"
+                    name="readwise-token"
+                    id="readwise-token"
+                    className="shadow-sm focus:ring-indigo-500 focus:border-indigo-500 block w-full sm:text-sm border-gray-300 dark:bg-gray-200 focus:bg-white rounded-md"
+                    placeholder="Your access token goes here"
+                    value={readwiseTokenInput}
+                  />
+                </div>
+                <div className="w-full mt-4 sm:flex flex-row">
+                  <button
+                    onClick={saveReadwiseToken}
+                    type="submit"
+                    className="mt-3 w-full inline-flex items-center justify-center px-4 py-2 border border-transparent shadow-sm font-medium rounded-md text-white bg-indigo-600 hover:bg-indigo-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-indigo-500 sm:mt-0 sm:ml-3 sm:text-sm"
+                  >
+                    Save
+                  </button>
+                </div>
+              </form>
+            </div>
+          </div>
+          <div className="shadow overflow-hidden sm:rounded-md">
+            <div className="px-4 py-5 bg-white dark:bg-slate-700 space-y-6 sm:p-6">
+              <fieldset>
+                <legend className="text-base font-medium text-gray-900 dark:text-gray-300">
+                  Sync destinations
+                </legend>
+                <div className="mt-4 space-y-4">
+                  {destinations.map((destination) => (
+                    <div key={destination.name} className="flex items-start">
+                      <div className="flex items-center h-5">
+                        <input
+                          id={`destination-${destination.name}`}
+                          name={`destination-${destination.name}`}
+                          type="checkbox"
+                          checked={destination.enabled}
+                          disabled={
+                            destination.name === "markdown" &&
+                            !vaultPath &&
+                            !destination.enabled
+                          }
+                          onChange={() => toggleDestination(destination.name)}
+                          className="focus:ring-indigo-500 h-4 w-4 text-indigo-600 border-gray-300 rounded"
+                        />
+                      </div>
+                      <div className="ml-3 text-sm">
+                        <label
+                          htmlFor={`destination-${destination.name}`}
+                          className="font-medium text-gray-700 dark:text-gray-300 capitalize"
+                        >
+                          {destination.name}
+                        </label>
+                        {destination.name === "markdown" && !vaultPath && (
+                          <p className="text-gray-500 dark:text-gray-400">
+                            Choose a vault folder below before turning this on.
+                          </p>
+                        )}
+                      </div>
+                    </div>
+                  ))}
+                </div>
+              </fieldset>
+            </div>
+          </div>
+          <div className="bg-white dark:bg-slate-700 shadow sm:rounded-lg">
+            <div className="px-4 py-5 sm:p-6">
+              <h3 className="text-lg leading-6 font-medium text-gray-900 dark:text-gray-300">
+                Choose your Markdown vault
+              </h3>
+              <div className="mt-2 max-w-xl text-sm text-gray-500 dark:text-gray-400">
+                <p>
+                  The Markdown destination writes one file per book into this
+                  folder, such as an Obsidian or Logseq vault.
+                </p>
+                <p className="mt-2 break-all">
+                  {vaultPath
+                    ? `Current folder: ${vaultPath}`
+                    : "No folder chosen yet"}
+                </p>
+              </div>
+              <div className="w-full mt-4 sm:flex flex-row">
+                <button
+                  onClick={chooseVaultPath}
+                  type="button"
+                  className="mt-3 w-full inline-flex items-center justify-center px-4 py-2 border border-transparent shadow-sm font-medium rounded-md text-white bg-indigo-600 hover:bg-indigo-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-indigo-500 sm:mt-0 sm:ml-3 sm:text-sm"
+                >
+                  Choose folder
+                </button>
+              </div>
+            </div>
+          </div>
+          <div className="shadow overflow-hidden sm:rounded-md">
+            <div className="px-4 py-5 bg-white dark:bg-slate-700 space-y-6 sm:p-6">
+              <fieldset>
+                <legend className="text-base font-medium text-gray-900 dark:text-gray-300">
+                  What to sync
+                </legend>
+                <div className="mt-4 space-y-4">
+                  {bookmarkTypes.map((type) => (
+                    <div key={type} className="flex items-start">
+                      <div className="flex items-center h-5">
+                        <input
+                          id={`type-${type}`}
+                          name={`type-${type}`}
+                          type="checkbox"
+                          checked={enabledTypes.includes(type)}
+                          onChange={() => toggleBookmarkType(type)}
+                          className="focus:ring-indigo-500 h-4 w-4 text-indigo-600 border-gray-300 rounded"
+                        />
+                      </div>
+                      <div className="ml-3 text-sm">
+                        <label
+                          htmlFor={`type-${type}`}
+                          className="font-medium text-gray-700 dark:text-gray-300 capitalize"
+                        >
+                          {type}s
+                        </label>
+                      </div>
+                    </div>
+                  ))}
+                  <div className="flex items-start">
+                    <div className="flex items-center h-5">
+                      <input
+                        id="export-page-markers"
+                        name="export-page-markers"
+                        type="checkbox"
+                        checked={exportPageMarkers}
+                        onChange={toggleExportPageMarkers}
+                        className="focus:ring-indigo-500 h-4 w-4 text-indigo-600 border-gray-300 rounded"
+                      />
+                    </div>
+                    <div className="ml-3 text-sm">
+                      <label
+                        htmlFor="export-page-markers"
+                        className="font-medium text-gray-700 dark:text-gray-300"
+                      >
+                        Export dogears as page markers
+                      </label>
+                      <p className="text-gray-500 dark:text-gray-400">
+                        Dogears have no text so they are only included in
+                        exports, marking the chapter and progress of the page.
+                      </p>
+                    </div>
+                  </div>
+                  <div className="flex items-start">
+                    <div className="flex items-center h-5">
+                      <input
+                        id="include-hidden-highlights"
+                        name="include-hidden-highlights"
+                        type="checkbox"
+                        checked={includeHidden}
+                        onChange={toggleIncludeHidden}
+                        className="focus:ring-indigo-500 h-4 w-4 text-indigo-600 border-gray-300 rounded"
+                      />
+                    </div>
+                    <div className="ml-3 text-sm">
+                      <label
+                        htmlFor="include-hidden-highlights"
+                        className="font-medium text-gray-700 dark:text-gray-300"
+                      >
+                        Include highlights deleted on your Kobo
+                      </label>
+                      <p className="text-gray-500 dark:text-gray-400">
+                        Kobo keeps deleted highlights around but hides them.
+                      </p>
+                    </div>
+                  </div>
+                  <div className="flex items-start">
+                    <div className="text-sm w-full">
+                      <label
+                        htmlFor="context-length"
+                        className="font-medium text-gray-700 dark:text-gray-300"
+                      >
+                        Surrounding text
+                      </label>
+                      <p className="text-gray-500 dark:text-gray-400">
+                        How many characters of the text around each highlight
+                        to include, so that short highlights make sense on their
+                        own. Set to 0 to leave it out.
+                      </p>
+                      <div className="mt-2 sm:flex sm:items-center">
+                        <input
+                          onChange={(e) => setContextLength(e.target.value)}
+                          onBlur={saveContextLength}
+                          type="number"
+                          min="0"
+                          max="1000"
+                          name="context-length"
+                          id="context-length"
+                          className="shadow-sm focus:ring-indigo-500 focus:border-indigo-500 block w-32 sm:text-sm border-gray-300 dark:bg-gray-200 focus:bg-white rounded-md"
+                          value={contextLength}
+                        />
+                      </div>
+                    </div>
+                  </div>
+                </div>
+              </fieldset>
+            </div>
+          </div>
+          <div className="bg-white dark:bg-slate-700 shadow sm:rounded-lg">
+            <div className="px-4 py-5 sm:p-6">
+              <h3 className="text-lg leading-6 font-medium text-gray-900 dark:text-gray-300">
+                Tag highlights by colour
+              </h3>
+              <div className="mt-2 max-w-xl text-sm text-gray-500 dark:text-gray-400">
+                <p>
+                  Newer Kobo firmware lets you pick a colour for each highlight.
+                  Highlights of a colour with a tag are sent with that tag.
+                </p>
+              </div>
+              <form
+                onSubmit={(e) => e.preventDefault()}
+                className="sm:flex flex-col"
+              >
+                {highlightColours.map((colour) => (
+                  <div
+                    key={colour}
+                    className="w-full mt-4 sm:flex sm:items-center"
+                  >
+                    <label
+                      htmlFor={`colour-${colour}`}
+                      className="w-20 text-sm font-medium text-gray-700 dark:text-gray-300 capitalize"
+                    >
+                      {colour}
+                    </label>
+                    <input
+                      onChange={(e) =>
+                        setColourTags({
+                          ...colourTags,
+                          [colour]: e.target.value,
+                        })
+                      }
+                      type="text"
+                      name={`colour-${colour}`}
+                      id={`colour-${colour}`}
+                      className="shadow-sm focus:ring-indigo-500 focus:border-indigo-500 block w-full sm:text-sm border-gray-300 dark:bg-gray-200 focus:bg-white rounded-md"
+                      placeholder="No tag"
+                      value={colourTags[colour] || ""}
+                    />
+                  </div>
+                ))}
+                <div className="w-full mt-4 sm:flex flex-row">
+                  <button
+                    onClick={saveColourTags}
+                    type="submit"
+                    className="mt-3 w-full inline-flex items-center justify-center px-4 py-2 border border-transparent shadow-sm font-medium rounded-md text-white bg-indigo-600 hover:bg-indigo-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-indigo-500 sm:mt-0 sm:ml-3 sm:text-sm"
+                  >
+                    Save
+                  </button>
+                </div>
+              </form>
+            </div>
+          </div>
           <div className="shadow overflow-hidden sm:rounded-md">
             <div className="px-4 py-5 bg-white dark:bg-slate-700 space-y-6 sm:p-6">
               <fieldset>
@@ -2,8 +2,14 @@
 // This file is automatically generated. DO NOT EDIT
 import {backend} from '../models';
 
+export function BackupKobo():Promise<backend.BackupInfo>;
+
 export function DetectKobos():Promise<Array<backend.Kobo>>;
 
+export function ExportHighlights():Promise<Array<backend.ExportRecord>>;
+
+export function ForgetOrphanedHighlights():Promise<Array<backend.OrphanedHighlight>>;
+
 export function FormatSystemDetails():Promise<string>;
 
 export function ForwardToNotado():Promise<number>;
@@ -14,12 +20,34 @@ export function GetContent():Promise<backend.Content>;
 
 export function GetPlainSystemDetails():Promise<string>;
 
+export function GetReadingStats():Promise<backend.ReadingStats>;
+
 export function GetSelectedKobo():Promise<backend.Kobo>;
 
 export function GetSettings():Promise<backend.Settings>;
 
+export function ListBackups():Promise<Array<backend.BackupInfo>>;
+
+export function ListDestinations():Promise<Array<backend.DestinationStatus>>;
+
+export function ListOrphanedHighlights():Promise<Array<backend.OrphanedHighlight>>;
+
 export function NavigateExplorerToLogLocation():Promise<void>;
 
+export function PreviewNotadoSync():Promise<backend.SyncPreview>;
+
 export function PromptForLocalDBPath():Promise<void>;
 
+export function PromptForMarkdownVaultPath():Promise<void>;
+
+export function ResetSyncState():Promise<void>;
+
+export function RestoreBackup(arg1:string,arg2:string):Promise<void>;
+
 export function SelectKobo(arg1:string):Promise<void>;
+
+export function SelectLocalKobo(arg1:string,arg2:string):Promise<void>;
+
+export function SyncHighlights():Promise<Array<backend.SyncResult>>;
+
+export function SyncHighlightsTo(arg1:Array<string>):Promise<Array<backend.SyncResult>>;
@@ -2,10 +2,22 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function BackupKobo() {
+  return window['go']['backend']['Backend']['BackupKobo']();
+}
+
 export function DetectKobos() {
   return window['go']['backend']['Backend']['DetectKobos']();
 }
 
+export function ExportHighlights() {
+  return window['go']['backend']['Backend']['ExportHighlights']();
+}
+
+export function ForgetOrphanedHighlights() {
+  return window['go']['backend']['Backend']['ForgetOrphanedHighlights']();
+}
+
 export function FormatSystemDetails() {
   return window['go']['backend']['Backend']['FormatSystemDetails']();
 }
@@ -26,6 +38,10 @@ export function GetPlainSystemDetails() {
   return window['go']['backend']['Backend']['GetPlainSystemDetails']();
 }
 
+export function GetReadingStats() {
+  return window['go']['backend']['Backend']['GetReadingStats']();
+}
+
 export function GetSelectedKobo() {
   return window['go']['backend']['Backend']['GetSelectedKobo']();
 }
@@ -34,14 +50,54 @@ export function GetSettings() {
   return window['go']['backend']['Backend']['GetSettings']();
 }
 
+export function ListBackups() {
+  return window['go']['backend']['Backend']['ListBackups']();
+}
+
+export function ListDestinations() {
+  return window['go']['backend']['Backend']['ListDestinations']();
+}
+
+export function ListOrphanedHighlights() {
+  return window['go']['backend']['Backend']['ListOrphanedHighlights']();
+}
+
 export function NavigateExplorerToLogLocation() {
   return window['go']['backend']['Backend']['NavigateExplorerToLogLocation']();
 }
 
+export function PreviewNotadoSync() {
+  return window['go']['backend']['Backend']['PreviewNotadoSync']();
+}
+
 export function PromptForLocalDBPath() {
   return window['go']['backend']['Backend']['PromptForLocalDBPath']();
 }
 
+export function PromptForMarkdownVaultPath() {
+  return window['go']['backend']['Backend']['PromptForMarkdownVaultPath']();
+}
+
+export function ResetSyncState() {
+  return window['go']['backend']['Backend']['ResetSyncState']();
+}
+
+export function RestoreBackup(arg1, arg2) {
+  return window['go']['backend']['Backend']['RestoreBackup'](arg1, arg2);
+}
+
 export function SelectKobo(arg1) {
   return window['go']['backend']['Backend']['SelectKobo'](arg1);
 }
+
+export function SelectLocalKobo(arg1, arg2) {
+  return window['go']['backend']['Backend']['SelectLocalKobo'](arg1, arg2);
+}
+
+export function SyncHighlights() {
+  return window['go']['backend']['Backend']['SyncHighlights']();
+}
+
+export function SyncHighlightsTo(arg1) {
+  return window['go']['backend']['Backend']['SyncHighlightsTo'](arg1);
+}
@@ -1,12 +1,17 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 import {backend} from '../models';
+import {gorm} from '../models';
 import {slog} from '../models';
 
+export function BuildChapterIndex(arg1:Array<backend.Content>,arg2:slog.Logger):Promise<Record<string, backend.Content>>;
+
 export function BuildContentIndex(arg1:Array<backend.Content>,arg2:slog.Logger):Promise<Record<string, backend.Content>>;
 
-export function CountDeviceBookmarks(arg1:slog.Logger):Promise<backend.HighlightCounts>;
+export function CountDeviceBookmarks(arg1:gorm.DB,arg2:boolean,arg3:Array<string>,arg4:slog.Logger):Promise<backend.HighlightCounts>;
+
+export function ListDeviceBookmarks(arg1:boolean,arg2:boolean,arg3:Array<string>,arg4:slog.Logger):Promise<Array<backend.Bookmark>>;
 
-export function ListDeviceBookmarks(arg1:boolean,arg2:slog.Logger):Promise<Array<backend.Bookmark>>;
+export function ListDeviceChapters(arg1:slog.Logger):Promise<Array<backend.Content>>;
 
 export function ListDeviceContent(arg1:boolean,arg2:slog.Logger):Promise<Array<backend.Content>>;
@@ -2,16 +2,24 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function BuildChapterIndex(arg1, arg2) {
+  return window['go']['backend']['Kobo']['BuildChapterIndex'](arg1, arg2);
+}
+
 export function BuildContentIndex(arg1, arg2) {
   return window['go']['backend']['Kobo']['BuildContentIndex'](arg1, arg2);
 }
 
-export function CountDeviceBookmarks(arg1) {
-  return window['go']['backend']['Kobo']['CountDeviceBookmarks'](arg1);
+export function CountDeviceBookmarks(arg1, arg2, arg3, arg4) {
+  return window['go']['backend']['Kobo']['CountDeviceBookmarks'](arg1, arg2, arg3, arg4);
+}
+
+export function ListDeviceBookmarks(arg1, arg2, arg3, arg4) {
+  return window['go']['backend']['Kobo']['ListDeviceBookmarks'](arg1, arg2, arg3, arg4);
 }
 
-export function ListDeviceBookmarks(arg1, arg2) {
-  return window['go']['backend']['Kobo']['ListDeviceBookmarks'](arg1, arg2);
+export function ListDeviceChapters(arg1) {
+  return window['go']['backend']['Kobo']['ListDeviceChapters'](arg1);
 }
 
 export function ListDeviceContent(arg1, arg2) {
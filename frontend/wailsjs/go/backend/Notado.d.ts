@@ -2,4 +2,6 @@
 // This file is automatically generated. DO NOT EDIT
 import {backend} from '../models';
 
-export function SendBookmarks(arg1:Array<backend.Response>,arg2:string):Promise<number>;
+export function SendBookmarks(arg1:Array<backend.Response>,arg2:string):Promise<backend.SendResult>;
+
+export function SetEndpoint(arg1:string):Promise<void>;
@@ -5,3 +5,7 @@
 export function SendBookmarks(arg1, arg2) {
   return window['go']['backend']['Notado']['SendBookmarks'](arg1, arg2);
 }
+
+export function SetEndpoint(arg1) {
+  return window['go']['backend']['Notado']['SetEndpoint'](arg1);
+}
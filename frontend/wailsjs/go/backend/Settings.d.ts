@@ -1,8 +1,37 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {backend} from '../models';
+
+export function Path():Promise<string>;
+
+export function Redacted():Promise<backend.Settings>;
 
 export function Save():Promise<void>;
 
+export function SaveBackupBeforeSync(arg1:boolean):Promise<void>;
+
+export function SaveBackupRetention(arg1:number):Promise<void>;
+
+export function SaveBookmarkTypes(arg1:Array<string>):Promise<void>;
+
+export function SaveContextLength(arg1:number):Promise<void>;
+
+export function SaveDestinations(arg1:Array<string>):Promise<void>;
+
+export function SaveExportPageMarkers(arg1:boolean):Promise<void>;
+
+export function SaveHighlightColourTags(arg1:Record<string, string>):Promise<void>;
+
+export function SaveIncludeHiddenHighlights(arg1:boolean):Promise<void>;
+
+export function SaveMarkdownVaultPath(arg1:string):Promise<void>;
+
+export function SaveNotadoEndpoint(arg1:string):Promise<void>;
+
+export function SaveReadwiseToken(arg1:string):Promise<void>;
+
 export function SaveStoreHighlights(arg1:boolean):Promise<void>;
 
 export function SaveToken(arg1:string):Promise<void>;
+
+export function SetOption(arg1:string,arg2:string):Promise<void>;
@@ -2,10 +2,62 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function Path() {
+  return window['go']['backend']['Settings']['Path']();
+}
+
+export function Redacted() {
+  return window['go']['backend']['Settings']['Redacted']();
+}
+
 export function Save() {
   return window['go']['backend']['Settings']['Save']();
 }
 
+export function SaveBackupBeforeSync(arg1) {
+  return window['go']['backend']['Settings']['SaveBackupBeforeSync'](arg1);
+}
+
+export function SaveBackupRetention(arg1) {
+  return window['go']['backend']['Settings']['SaveBackupRetention'](arg1);
+}
+
+export function SaveBookmarkTypes(arg1) {
+  return window['go']['backend']['Settings']['SaveBookmarkTypes'](arg1);
+}
+
+export function SaveContextLength(arg1) {
+  return window['go']['backend']['Settings']['SaveContextLength'](arg1);
+}
+
+export function SaveDestinations(arg1) {
+  return window['go']['backend']['Settings']['SaveDestinations'](arg1);
+}
+
+export function SaveExportPageMarkers(arg1) {
+  return window['go']['backend']['Settings']['SaveExportPageMarkers'](arg1);
+}
+
+export function SaveHighlightColourTags(arg1,  string>) {
+  return window['go']['backend']['Settings']['SaveHighlightColourTags'](arg1,  string>);
+}
+
+export function SaveIncludeHiddenHighlights(arg1) {
+  return window['go']['backend']['Settings']['SaveIncludeHiddenHighlights'](arg1);
+}
+
+export function SaveMarkdownVaultPath(arg1) {
+  return window['go']['backend']['Settings']['SaveMarkdownVaultPath'](arg1);
+}
+
+export function SaveNotadoEndpoint(arg1) {
+  return window['go']['backend']['Settings']['SaveNotadoEndpoint'](arg1);
+}
+
+export function SaveReadwiseToken(arg1) {
+  return window['go']['backend']['Settings']['SaveReadwiseToken'](arg1);
+}
+
 export function SaveStoreHighlights(arg1) {
   return window['go']['backend']['Settings']['SaveStoreHighlights'](arg1);
 }
@@ -13,3 +65,7 @@ export function SaveStoreHighlights(arg1) {
 export function SaveToken(arg1) {
   return window['go']['backend']['Settings']['SaveToken'](arg1);
 }
+
+export function SetOption(arg1, arg2) {
+  return window['go']['backend']['Settings']['SetOption'](arg1, arg2);
+}
@@ -1,5 +1,133 @@
 export namespace backend {
 	
+	export class BackupInfo {
+	    name: string;
+	    path: string;
+	    device: string;
+	    created_at: string;
+	    size: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BackupInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.path = source["path"];
+	        this.device = source["device"];
+	        this.created_at = source["created_at"];
+	        this.size = source["size"];
+	    }
+	}
+	export class BatchResult {
+	    batch: number;
+	    count: number;
+	    attempts: number;
+	    sent: boolean;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new BatchResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.batch = source["batch"];
+	        this.count = source["count"];
+	        this.attempts = source["attempts"];
+	        this.sent = source["sent"];
+	        this.error = source["error"];
+	    }
+	}
+	export class BookHighlights {
+	    title: string;
+	    author: string;
+	    highlights: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BookHighlights(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.title = source["title"];
+	        this.author = source["author"];
+	        this.highlights = source["highlights"];
+	    }
+	}
+	export class BookPreview {
+	    title: string;
+	    author: string;
+	    highlights: HighlightPreview[];
+	
+	    static createFrom(source: any = {}) {
+	        return new BookPreview(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.title = source["title"];
+	        this.author = source["author"];
+	        this.highlights = this.convertValues(source["highlights"], HighlightPreview);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class BookProgress {
+	    title: string;
+	    author: string;
+	    percent_read: number;
+	    time_spent: number;
+	    last_read: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new BookProgress(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.title = source["title"];
+	        this.author = source["author"];
+	        this.percent_read = source["percent_read"];
+	        this.time_spent = source["time_spent"];
+	        this.last_read = source["last_read"];
+	    }
+	}
+	export class BookResult {
+	    title: string;
+	    author: string;
+	    highlights: number;
+	    synced: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BookResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.title = source["title"];
+	        this.author = source["author"];
+	        this.highlights = source["highlights"];
+	        this.synced = source["synced"];
+	    }
+	}
 	export class Bookmark {
 	    bookmark_id: string;
 	    volume_id: string;
@@ -26,6 +154,13 @@ export namespace backend {
 	    Published: string;
 	    ContextString: string;
 	    Type: string;
+	    chapter_title: string;
+	    chapter_index: number;
+	    book_progress: number;
+	    position: number;
+	    colour: string;
+	    markup_path: string;
+	    context: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new Bookmark(source);
@@ -58,6 +193,13 @@ export namespace backend {
 	        this.Published = source["Published"];
 	        this.ContextString = source["ContextString"];
 	        this.Type = source["Type"];
+	        this.chapter_title = source["chapter_title"];
+	        this.chapter_index = source["chapter_index"];
+	        this.book_progress = source["book_progress"];
+	        this.position = source["position"];
+	        this.colour = source["colour"];
+	        this.markup_path = source["markup_path"];
+	        this.context = source["context"];
 	    }
 	}
 	export class Content {
@@ -256,6 +398,64 @@ export namespace backend {
 	        this.DateModified = source["DateModified"];
 	    }
 	}
+	export class DestinationStatus {
+	    name: string;
+	    enabled: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new DestinationStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.enabled = source["enabled"];
+	    }
+	}
+	export class ExportRecord {
+	    bookmark_id: string;
+	    book_title: string;
+	    author: string;
+	    isbn: string;
+	    chapter: string;
+	    chapter_index: number;
+	    text: string;
+	    context: string;
+	    annotation: string;
+	    type: string;
+	    colour: string;
+	    chapter_progress: number;
+	    book_progress: number;
+	    date_created: string;
+	    date_modified: string;
+	    origin: string;
+	    markup: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ExportRecord(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.bookmark_id = source["bookmark_id"];
+	        this.book_title = source["book_title"];
+	        this.author = source["author"];
+	        this.isbn = source["isbn"];
+	        this.chapter = source["chapter"];
+	        this.chapter_index = source["chapter_index"];
+	        this.text = source["text"];
+	        this.context = source["context"];
+	        this.annotation = source["annotation"];
+	        this.type = source["type"];
+	        this.colour = source["colour"];
+	        this.chapter_progress = source["chapter_progress"];
+	        this.book_progress = source["book_progress"];
+	        this.date_created = source["date_created"];
+	        this.date_modified = source["date_modified"];
+	        this.origin = source["origin"];
+	        this.markup = source["markup"];
+	    }
+	}
 	export class Highlight {
 	    content: string;
 	    url: string;
@@ -294,12 +494,45 @@ export namespace backend {
 	        this.official = source["official"];
 	    }
 	}
+	export class HighlightPreview {
+	    bookmark_id: string;
+	    batch: number;
+	    chapter: string;
+	    book_progress: number;
+	    chunk: number;
+	    chunk_count: number;
+	    content: string;
+	    url: string;
+	    created: string;
+	    tags: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new HighlightPreview(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.bookmark_id = source["bookmark_id"];
+	        this.batch = source["batch"];
+	        this.chapter = source["chapter"];
+	        this.book_progress = source["book_progress"];
+	        this.chunk = source["chunk"];
+	        this.chunk_count = source["chunk_count"];
+	        this.content = source["content"];
+	        this.url = source["url"];
+	        this.created = source["created"];
+	        this.tags = source["tags"];
+	    }
+	}
 	export class Kobo {
 	    name: string;
 	    storage: number;
 	    display_ppi: number;
 	    mnt_path: string;
 	    db_path: string;
+	    serial: string;
+	    firmware_version: string;
+	    device_id: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new Kobo(source);
@@ -312,7 +545,88 @@ export namespace backend {
 	        this.display_ppi = source["display_ppi"];
 	        this.mnt_path = source["mnt_path"];
 	        this.db_path = source["db_path"];
+	        this.serial = source["serial"];
+	        this.firmware_version = source["firmware_version"];
+	        this.device_id = source["device_id"];
+	    }
+	}
+	export class OrphanedHighlight {
+	    bookmark_id: string;
+	    destination: string;
+	    volume_id: string;
+	    text: string;
+	    synced_at: string;
+	    reason: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new OrphanedHighlight(source);
 	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.bookmark_id = source["bookmark_id"];
+	        this.destination = source["destination"];
+	        this.volume_id = source["volume_id"];
+	        this.text = source["text"];
+	        this.synced_at = source["synced_at"];
+	        this.reason = source["reason"];
+	    }
+	}
+	export class PeriodCount {
+	    period: string;
+	    books: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new PeriodCount(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.period = source["period"];
+	        this.books = source["books"];
+	    }
+	}
+	export class ReadingStats {
+	    total_reading_time: number;
+	    average_session: number;
+	    books_finished: number;
+	    finished_by_year: PeriodCount[];
+	    finished_by_month: PeriodCount[];
+	    currently_reading: BookProgress[];
+	    highlights_per_book: BookHighlights[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ReadingStats(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.total_reading_time = source["total_reading_time"];
+	        this.average_session = source["average_session"];
+	        this.books_finished = source["books_finished"];
+	        this.finished_by_year = this.convertValues(source["finished_by_year"], PeriodCount);
+	        this.finished_by_month = this.convertValues(source["finished_by_month"], PeriodCount);
+	        this.currently_reading = this.convertValues(source["currently_reading"], BookProgress);
+	        this.highlights_per_book = this.convertValues(source["highlights_per_book"], BookHighlights);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 	export class Response {
 	    highlights: Highlight[];
@@ -344,9 +658,54 @@ export namespace backend {
 		    return a;
 		}
 	}
+	export class SendResult {
+	    sent: number;
+	    batches: BatchResult[];
+	    first_failed_batch: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new SendResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.sent = source["sent"];
+	        this.batches = this.convertValues(source["batches"], BatchResult);
+	        this.first_failed_batch = source["first_failed_batch"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class Settings {
 	    notado_token: string;
 	    upload_store_highlights: boolean;
+	    notado_endpoint?: string;
+	    destinations: string[];
+	    markdown_vault_path?: string;
+	    readwise_token?: string;
+	    backup_before_sync: boolean;
+	    backup_retention: number;
+	    bookmark_types: string[];
+	    export_page_markers: boolean;
+	    include_hidden_highlights: boolean;
+	    highlight_colour_tags?: Record<string, string>;
+	    context_length: number;
 	
 	    static createFrom(source: any = {}) {
 	        return new Settings(source);
@@ -356,6 +715,110 @@ export namespace backend {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.notado_token = source["notado_token"];
 	        this.upload_store_highlights = source["upload_store_highlights"];
+	        this.notado_endpoint = source["notado_endpoint"];
+	        this.destinations = source["destinations"];
+	        this.markdown_vault_path = source["markdown_vault_path"];
+	        this.readwise_token = source["readwise_token"];
+	        this.backup_before_sync = source["backup_before_sync"];
+	        this.backup_retention = source["backup_retention"];
+	        this.bookmark_types = source["bookmark_types"];
+	        this.export_page_markers = source["export_page_markers"];
+	        this.include_hidden_highlights = source["include_hidden_highlights"];
+	        this.highlight_colour_tags = source["highlight_colour_tags"];
+	        this.context_length = source["context_length"];
+	    }
+	}
+	export class SyncPreview {
+	    books: BookPreview[];
+	    note_count: number;
+	    batch_count: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncPreview(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.books = this.convertValues(source["books"], BookPreview);
+	        this.note_count = source["note_count"];
+	        this.batch_count = source["batch_count"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class SyncResult {
+	    destination: string;
+	    sent: number;
+	    batches?: BatchResult[];
+	    first_failed_batch: number;
+	    error?: string;
+	    books?: BookResult[];
+	    orphaned?: OrphanedHighlight[];
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.destination = source["destination"];
+	        this.sent = source["sent"];
+	        this.batches = this.convertValues(source["batches"], BatchResult);
+	        this.first_failed_batch = source["first_failed_batch"];
+	        this.error = source["error"];
+	        this.books = this.convertValues(source["books"], BookResult);
+	        this.orphaned = this.convertValues(source["orphaned"], OrphanedHighlight);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
+export namespace gorm {
+	
+	export class DB {
+	    RowsAffected: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new DB(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.RowsAffected = source["RowsAffected"];
 	    }
 	}
 
@@ -2,7 +2,9 @@ package epub
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"path"
 
 	"github.com/taylorskalyo/goreader/epub"
 )
@@ -34,3 +36,28 @@ func LoadEpub(path string) (*epub.Rootfile, error) {
 	}
 	return rc.Rootfiles[0], nil
 }
+
+// ReadFile returns the contents of a single file within an epub, such as a chapter, where name is
+// the path of the file from the root of the epub or from its package file. The epub is closed
+// again before returning so that reading a chapter doesn't leave the book open.
+func ReadFile(epubPath string, name string) ([]byte, error) {
+	rc, err := epub.OpenReader(epubPath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	for _, rootfile := range rc.Rootfiles {
+		for _, item := range rootfile.Manifest.Items {
+			if item.HREF != name && path.Join(path.Dir(rootfile.FullPath), item.HREF) != name {
+				continue
+			}
+			r, err := item.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+			return io.ReadAll(r)
+		}
+	}
+	return nil, fmt.Errorf("no file named %s found in epub", name)
+}
@@ -1,5 +1,20 @@
 package kobo
 
+import "database/sql"
+
+// HighlightColour is the colour a reader picked for a highlight
+type HighlightColour string
+
+const (
+	HighlightColourYellow HighlightColour = "yellow"
+	HighlightColourPink   HighlightColour = "pink"
+	HighlightColourBlue   HighlightColour = "blue"
+	HighlightColourGreen  HighlightColour = "green"
+)
+
+// highlightColours are in the order that Kobo numbers them in the Color column
+var highlightColours = []HighlightColour{HighlightColourYellow, HighlightColourPink, HighlightColourBlue, HighlightColourGreen}
+
 type Bookmark struct {
 	BookmarkID               string  `db:"BookmarkID"`
 	VolumeID                 string  `db:"VolumeID"`
@@ -26,6 +41,17 @@ type Bookmark struct {
 	Published                bool    `db:"Published"`
 	ContextString            string  `db:"ContextString"`
 	Type                     string  `db:"Type"`
+	// Color only exists on firmware that supports coloured highlights so it is left invalid
+	// when reading a database from an older device
+	Color sql.NullInt64 `db:"Color"`
+}
+
+// Colour returns the colour of a highlight or an empty string if the device doesn't record one
+func (b Bookmark) Colour() HighlightColour {
+	if !b.Color.Valid || b.Color.Int64 < 0 || b.Color.Int64 >= int64(len(highlightColours)) {
+		return ""
+	}
+	return highlightColours[b.Color.Int64]
 }
 
 func CountBookmarks(kobo *Kobo) (int, error) {
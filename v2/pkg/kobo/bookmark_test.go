@@ -0,0 +1,25 @@
+package kobo
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestBookmarkColour(t *testing.T) {
+	tests := []struct {
+		expected HighlightColour
+		input    sql.NullInt64
+	}{
+		{expected: HighlightColourYellow, input: sql.NullInt64{Int64: 0, Valid: true}},
+		{expected: HighlightColourGreen, input: sql.NullInt64{Int64: 3, Valid: true}},
+		// Databases from older firmware don't have a colour at all
+		{expected: "", input: sql.NullInt64{}},
+		{expected: "", input: sql.NullInt64{Int64: 7, Valid: true}},
+	}
+	for _, tc := range tests {
+		actual := Bookmark{Color: tc.input}.Colour()
+		if actual != tc.expected {
+			t.Errorf("expected %q but got %q for %+v", tc.expected, actual, tc.input)
+		}
+	}
+}